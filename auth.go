@@ -69,7 +69,7 @@ func GetCredentials(
 		)
 	}
 
-	baseURL := url.Scheme + "://" + url.Host
+	baseURL := url.Scheme + "://" + url.Host + contextPath(url.Path)
 
 	if url.Host == "" {
 		baseURL = flags.BaseURL
@@ -98,3 +98,24 @@ func GetCredentials(
 
 	return creds, nil
 }
+
+// confluencePaths are paths of pages in Confluence web interface, which are
+// preceded by context path, if Confluence is served under it.
+var confluencePaths = []string{
+	"/pages/",
+	"/display/",
+	"/spaces/",
+	"/x/",
+}
+
+// contextPath returns context path of Confluence from path of page URL, e.g.
+// /wiki for /wiki/spaces/DOCS/pages/123.
+func contextPath(path string) string {
+	for _, known := range confluencePaths {
+		if index := strings.Index(path, known); index >= 0 {
+			return path[:index]
+		}
+	}
+
+	return ""
+}
@@ -1,15 +1,192 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/kovetskiy/ko"
+	"github.com/kovetskiy/mark/pkg/mark"
+	"github.com/kovetskiy/toml"
 )
 
 type Config struct {
 	Username string `env:"MARK_USERNAME" toml:"username"`
 	Password string `env:"MARK_PASSWORD" toml:"password"`
 	BaseURL  string `env:"MARK_BASE_URL" toml:"base_url"`
+
+	// HTTP headers sent with every request to Confluence.
+	UserAgent string            `toml:"user_agent"`
+	Headers   map[string]string `toml:"headers"`
+
+	// Settings of HTTP client, timeouts are in seconds, see
+	// confluence.Options.
+	DialTimeout        int `toml:"dial_timeout"`
+	ResponseTimeout    int `toml:"response_timeout"`
+	KeepAlive          int `toml:"keep_alive"`
+	MaxIdleConnections int `toml:"max_idle_connections"`
+
+	// Encoding of markdown files without byte order mark, see
+	// mark.DecodeInput.
+	InputEncoding string `toml:"input_encoding"`
+
+	DefaultSpace  string `env:"MARK_DEFAULT_SPACE" toml:"default_space"`
+	DefaultParent string `env:"MARK_DEFAULT_PARENT" toml:"default_parent"`
+
+	// Labels added to every page in addition to ones specified in headers.
+	DefaultLabels []string `toml:"default_labels"`
+
+	// HTML macro allows arbitrary HTML on page, so it's disabled by default
+	// on Confluence side and should be explicitly allowed here as well.
+	HTMLMacro bool `toml:"html_macro"`
+
+	// Keep entities escaped twice in compiled page as is instead of
+	// unescaping them, see mark.NormalizeEntities.
+	StrictEntities bool `toml:"strict_entities"`
+
+	// Iframe and widget connector macros are often restricted on Confluence
+	// side, so ```iframe and ```widget code blocks should be explicitly
+	// allowed here as well.
+	EmbedMacros bool `toml:"embed_macros"`
+
+	// Tables with at least that many columns are wrapped into horizontally
+	// scrollable container, zero disables wrapping.
+	WideTableColumns int `toml:"wide_table_columns"`
+
+	// Add banner explaining that page is managed by mark on top of every
+	// page, see mark.AddManagedBanner.
+	ManagedBanner     bool   `toml:"managed_banner"`
+	ManagedBannerText string `toml:"managed_banner_text"`
+
+	// Render documents embedded as images as download links instead of
+	// viewer macros, which are not available on some instances.
+	DocumentLinks bool `toml:"document_links"`
+
+	// Render Pandoc-style subscript like H~2~O and superscript like x^2^,
+	// which syntax may collide with other markdown dialects.
+	SubSuperscript bool `toml:"sub_superscript"`
+
+	// Store date of last change of page source in content property, see
+	// mark.SourceUpdated.
+	SourceUpdated bool `toml:"source_updated"`
+
+	// Prefix headings with hierarchical numbers, starting from headings of
+	// specified level, 2 by default, see mark.CompileOptions.HeadingNumbers.
+	HeadingNumbers      bool `toml:"heading_numbers"`
+	HeadingNumbersLevel int  `toml:"heading_numbers_level"`
+
+	// Format of compiled page: pretty or minify, see mark.FormatHTML.
+	HTMLFormat string `toml:"html_format"`
+
+	// Display image alt text as caption below the image.
+	ImageCaptions bool `toml:"image_captions"`
+
+	// Keep HTML comments in compiled page instead of removing them.
+	KeepComments bool `toml:"keep_comments"`
+
+	// Directories where attachments, which are not found in attachments
+	// directory, are looked up in order, see mark.FindAttachment.
+	AttachmentSearchPaths []string `toml:"attachment_search_paths"`
+
+	// Handling of failed uploads of attachments, see
+	// mark.AttachmentPolicy.
+	AttachmentRetries     int  `toml:"attachment_retries"`
+	SkipFailedAttachments bool `toml:"skip_failed_attachments"`
+
+	// File which headers are used as defaults for headers of every file,
+	// see mark.Meta.Merge.
+	MetaDefaults   string `toml:"meta_defaults"`
+	MergeMetaLists bool   `toml:"merge_meta_lists"`
+
+	// Size of compiled page body in bytes, which pages approaching are
+	// reported, see mark.CheckPageSize.
+	PageSizeLimit int `toml:"page_size_limit"`
+
+	// Directory where included templates are looked up, see
+	// includes.LoadTemplate.
+	IncludesDir string `toml:"includes_dir"`
+
+	// Markdown files which are added before and after every page contents.
+	Prepend string `toml:"prepend"`
+	Append  string `toml:"append"`
+
+	TitleFromFilename bool     `toml:"title_from_filename"`
+	TitleTransforms   []string `toml:"title_transforms"`
+
+	// Suffix appended to title of page, which title is already taken by page
+	// created from another file, for --title-conflict suffix. Suffix can
+	// contain %d, which is replaced by number starting from 2.
+	TitleConflictSuffix string `toml:"title_conflict_suffix"`
+
+	// Settings for --check-external-links.
+	LinkCheckConcurrency int      `toml:"link_check_concurrency"`
+	LinkCheckTimeout     int      `toml:"link_check_timeout"`
+	LinkCheckSkipDomains []string `toml:"link_check_skip_domains"`
+
+	// Normalizations applied before comparing page contents with contents
+	// of page in Confluence for --skip-unchanged, see mark.NormalizeHTML.
+	CompareNormalize []string `toml:"compare_normalize"`
+
+	// Languages of fenced code blocks mapped to languages supported by
+	// Confluence code macro, see mark.CodeLanguage.
+	LanguageAliases map[string]string `toml:"language_aliases"`
+
+	// Bare links to these domains are rendered as smart links.
+	SmartLinkDomains []string `toml:"smart_link_domains"`
+
+	// External links to these domains open in new window, "*" matches every
+	// domain except domain of Confluence.
+	NewWindowDomains []string `toml:"new_window_domains"`
+
+	// Emoji shortcodes (without colons) mapped to Confluence emoticon names
+	// or paths to images, see mark.CompileEmoji.
+	Emoji map[string]string `toml:"emoji"`
+
+	// Transformers applied to markdown before compiling, see
+	// mark.LoadTransformers.
+	Transformers []string `toml:"transformers"`
+
+	// Find/replace rules applied to markdown in order before transformers,
+	// see mark.NewReplacer.
+	Replacements []mark.Replacement `toml:"replace"`
+
+	// Use pages of index files as parent pages of other files in their
+	// directories, see mark.Folders.
+	FolderIndex bool `toml:"folder_index"`
+
+	// Names of index files, which default to index.md and README.md.
+	IndexFilenames []string `toml:"index_filenames"`
+
+	// Add redirect macro, which is provided by third-party app, to pages
+	// created at previous titles of renamed pages, see mark.RenderRedirect.
+	RedirectMacro bool `toml:"redirect_macro"`
+
+	// Macros allowed on Confluence side, other macros are removed from
+	// compiled pages with warning, see mark.FilterMacros.
+	AllowedMacros []string `toml:"allowed_macros"`
+
+	// Macros rejected by Confluence, which are removed from compiled pages
+	// with warning.
+	DeniedMacros []string `toml:"denied_macros"`
+
+	// Variables available in every template and page title, which are
+	// overridden by --data file.
+	Data map[string]interface{} `toml:"data"`
+
+	// Markers of review notes like <!-- REVIEW: ... -->, which are never
+	// published, see mark.ExtractNotes.
+	NoteMarkers []string `toml:"note_markers"`
+
+	Profiles map[string]Profile `toml:"profiles"`
+}
+
+// Profile holds credentials for one of Confluence instances, selected using
+// --profile flag.
+type Profile struct {
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	BaseURL  string `toml:"base_url"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -25,3 +202,67 @@ func LoadConfig(path string) (*Config, error) {
 
 	return config, nil
 }
+
+// WithProfile returns copy of config with credentials overridden by fields
+// set in the specified profile.
+func (config *Config) WithProfile(name string) (*Config, error) {
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf(
+			"profile %q is not found in configuration file",
+			name,
+		)
+	}
+
+	result := *config
+
+	if profile.Username != "" {
+		result.Username = profile.Username
+	}
+
+	if profile.Password != "" {
+		result.Password = profile.Password
+	}
+
+	if profile.BaseURL != "" {
+		result.BaseURL = profile.BaseURL
+	}
+
+	return &result, nil
+}
+
+// Dump writes configuration in TOML format, passwords and values of headers
+// which may contain credentials are masked.
+func (config *Config) Dump(writer io.Writer) error {
+	dump := *config
+
+	dump.Password = maskSecret(dump.Password)
+
+	dump.Headers = map[string]string{}
+	for name, value := range config.Headers {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || strings.Contains(lower, "cookie") ||
+			strings.Contains(lower, "token") {
+			value = maskSecret(value)
+		}
+
+		dump.Headers[name] = value
+	}
+
+	dump.Profiles = map[string]Profile{}
+	for name, profile := range config.Profiles {
+		profile.Password = maskSecret(profile.Password)
+
+		dump.Profiles[name] = profile
+	}
+
+	return toml.NewEncoder(writer).Encode(dump)
+}
+
+func maskSecret(value string) string {
+	if value == "" || value == "-" {
+		return value
+	}
+
+	return "<masked>"
+}
@@ -12,7 +12,7 @@ require (
 	github.com/kovetskiy/gopencils v0.0.0-20201105104258-2a0bfdd710fb
 	github.com/kovetskiy/ko v0.0.0-20190324102900-26b8dd0988bf
 	github.com/kovetskiy/lorg v0.0.0-20200107130803-9a7136a95634
-	github.com/kovetskiy/toml v0.2.0 // indirect
+	github.com/kovetskiy/toml v0.2.0
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/reconquest/karma-go v0.0.0-20200326104714-79480464fdb5
 	github.com/reconquest/pkg v0.0.0-20201028091908-8e9a5e0226ef
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kovetskiy/mark/pkg/confluence"
+	"github.com/kovetskiy/mark/pkg/mark"
+	"github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+)
+
+type indexNode struct {
+	page     *confluence.PageInfo
+	children map[string]*indexNode
+}
+
+// updateIndexPage creates or updates page with given title, which links all
+// pages uploaded during the run as nested list mirroring directories of
+// their files.
+func updateIndexPage(
+	api *confluence.API,
+	space string,
+	title string,
+	pages map[string]*confluence.PageInfo,
+	minorEdit bool,
+) (*confluence.PageInfo, error) {
+	if space == "" {
+		return nil, fmt.Errorf(
+			"space key of index page is not set (use --space flag " +
+				"or default_space config field)",
+		)
+	}
+
+	root := &indexNode{children: map[string]*indexNode{}}
+
+	for file, page := range pages {
+		node := root
+
+		parts := strings.Split(filepath.ToSlash(filepath.Clean(file)), "/")
+		for _, part := range parts {
+			if node.children[part] == nil {
+				node.children[part] = &indexNode{
+					children: map[string]*indexNode{},
+				}
+			}
+
+			node = node.children[part]
+		}
+
+		node.page = page
+	}
+
+	var buffer strings.Builder
+
+	renderIndex(&buffer, root, api.BaseURL)
+
+	index, err := mark.EnsureAncestry(false, api, space, []string{title})
+	if err != nil {
+		return nil, karma.Format(err, "unable to create index page %q", title)
+	}
+
+	// page returned on creation doesn't contain ancestors, which are
+	// required for update
+	index, err = api.GetPageByID(index.ID)
+	if err != nil {
+		return nil, karma.Format(err, "unable to retrieve index page")
+	}
+
+	err = api.UpdatePage(index, buffer.String(), minorEdit, nil, "")
+	if err != nil {
+		return nil, karma.Format(err, "unable to update index page")
+	}
+
+	log.Infof(nil, "index page updated: %s", api.BaseURL+index.Links.Full)
+
+	return index, nil
+}
+
+func renderIndex(buffer *strings.Builder, node *indexNode, baseURL string) {
+	if len(node.children) == 0 {
+		return
+	}
+
+	names := []string{}
+	for name := range node.children {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	buffer.WriteString("<ul>")
+
+	for _, name := range names {
+		child := node.children[name]
+
+		buffer.WriteString("<li>")
+
+		if child.page != nil {
+			fmt.Fprintf(
+				buffer,
+				`<a href="%s">%s</a>`,
+				html.EscapeString(baseURL+child.page.Links.Full),
+				html.EscapeString(child.page.Title),
+			)
+		} else {
+			buffer.WriteString(html.EscapeString(name))
+		}
+
+		renderIndex(buffer, child, baseURL)
+
+		buffer.WriteString("</li>")
+	}
+
+	buffer.WriteString("</ul>")
+}
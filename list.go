@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kovetskiy/mark/pkg/confluence"
+	"github.com/reconquest/karma-go"
+)
+
+type listedPage struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	ParentID string `json:"parent_id"`
+	Parent   string `json:"parent"`
+}
+
+// listPages prints pages of the space which titles start with given prefix.
+func listPages(
+	api *confluence.API,
+	space string,
+	prefix string,
+	format string,
+) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf(
+			"unexpected output format %q, expected text or json",
+			format,
+		)
+	}
+
+	pages, err := api.ListPages(space)
+	if err != nil {
+		return karma.Format(err, "unable to list pages of space %q", space)
+	}
+
+	listed := []listedPage{}
+
+	for _, page := range pages {
+		if !strings.HasPrefix(page.Title, prefix) {
+			continue
+		}
+
+		item := listedPage{
+			ID:    page.ID,
+			Title: page.Title,
+		}
+
+		if len(page.Ancestors) > 0 {
+			parent := page.Ancestors[len(page.Ancestors)-1]
+
+			item.ParentID = parent.Id
+			item.Parent = parent.Title
+		}
+
+		listed = append(listed, item)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(listed)
+	}
+
+	for _, page := range listed {
+		fmt.Printf("%s\t%s\t%s\n", page.ID, page.Title, page.Parent)
+	}
+
+	return nil
+}
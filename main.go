@@ -4,8 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docopt/docopt-go"
 	"github.com/kovetskiy/lorg"
@@ -20,18 +26,69 @@ import (
 
 type Flags struct {
 	FileGlobPatten string `docopt:"-f"`
+	Bundle         string `docopt:"--bundle"`
+	BundleEntry    string `docopt:"--bundle-entry"`
 	CompileOnly    bool   `docopt:"--compile-only"`
+	HTMLFormat     string `docopt:"--html-format"`
+	EmitStage      string `docopt:"--emit-stage"`
 	DryRun         bool   `docopt:"--dry-run"`
 	EditLock       bool   `docopt:"-k"`
+	LockOrder      string `docopt:"--lock-order"`
+	ManagedBanner  bool   `docopt:"--managed-banner"`
 	DropH1         bool   `docopt:"--drop-h1"`
+	HeadingAnchors bool   `docopt:"--heading-anchors"`
+	HeadingNumbers bool   `docopt:"--heading-numbers"`
+	Mentions       bool   `docopt:"--mentions"`
+	NewWindowLinks bool   `docopt:"--new-window-links"`
+	TitleFromFile  bool   `docopt:"--title-from-filename"`
+	TitleConflict  string `docopt:"--title-conflict"`
+	PrintID        bool   `docopt:"--print-id"`
+	State          string `docopt:"--state"`
+	Nav            string `docopt:"--nav"`
+	FolderIndex    bool   `docopt:"--folder-index"`
+	MetaDefaults   string `docopt:"--meta-defaults"`
+	Data           string `docopt:"--data"`
+	MergeMetaLists bool   `docopt:"--merge-meta-lists"`
+	IncludesDir    string `docopt:"--includes-dir"`
+	AttachmentsDir string `docopt:"--attachments-dir"`
+	IndexPage      string `docopt:"--index-page"`
+	CheckLinks     bool   `docopt:"--check-external-links"`
+	BrokenLinksErr bool   `docopt:"--fail-on-broken-links"`
+	AttachSource   bool   `docopt:"--attach-source"`
+	AttachRetries  int    `docopt:"--attachment-retries"`
+	SkipFailed     bool   `docopt:"--skip-failed-attachments"`
+	KeepComments   bool   `docopt:"--keep-comments"`
+	NoReplace      bool   `docopt:"--no-replace"`
+	ShowNotes      bool   `docopt:"--show-notes"`
+	NoRename       bool   `docopt:"--no-rename"`
+	SkipNoMeta     bool   `docopt:"--skip-no-metadata"`
+	Concurrency    int    `docopt:"--concurrency"`
+	Publish        bool   `docopt:"--publish"`
+	WriteBack      bool   `docopt:"--write-back"`
+	CheckVersion   bool   `docopt:"--check-version"`
+	SkipUnchanged  bool   `docopt:"--skip-unchanged"`
 	MinorEdit      bool   `docopt:"--minor-edit"`
 	Color          string `docopt:"--color"`
 	Debug          bool   `docopt:"--debug"`
 	Trace          bool   `docopt:"--trace"`
+	TraceRequests  bool   `docopt:"--trace-requests"`
+	Quiet          bool   `docopt:"--quiet"`
+	Strict         bool   `docopt:"--strict"`
+	DumpConfig     bool   `docopt:"--dump-config"`
+	SourceUpdated  bool   `docopt:"--source-updated"`
 	Username       string `docopt:"-u"`
+	Author         string `docopt:"--author"`
 	Password       string `docopt:"-p"`
 	TargetURL      string `docopt:"-l"`
 	BaseURL        string `docopt:"--base-url"`
+	Profile        string `docopt:"--profile"`
+	UserAgent      string `docopt:"--user-agent"`
+	InputEncoding  string `docopt:"--input-encoding"`
+	List           bool   `docopt:"--list"`
+	Space          string `docopt:"--space"`
+	Title          string `docopt:"--title"`
+	TitlePrefix    string `docopt:"--title-prefix"`
+	OutputFormat   string `docopt:"--output-format"`
 }
 
 const (
@@ -43,6 +100,9 @@ Docs: https://github.com/kovetskiy/mark
 Usage:
   mark [options] [-u <username>] [-p <token>] [-k] [-l <url>] -f <file>
   mark [options] [-u <username>] [-p <password>] [-k] [-b <url>] -f <file>
+  mark [options] [-u <username>] [-p <password>] [-k] [-b <url>] --bundle <file>
+  mark [options] [-u <username>] [-p <password>] [-b <url>] --space <key> --title <title> -f <file>
+  mark [options] [-u <username>] [-p <password>] [-b <url>] --list --space <key>
   mark -v | --version
   mark -h | --help
 
@@ -55,15 +115,114 @@ Options:
                         above).
   -b --base-url <url>  Base URL for Confluence.
                         Alternative option for base_url config field.
+  --profile <name>     Use credentials and base URL from specified profile of
+                        configuration file.
+  --user-agent <agent> Send specified User-Agent header to Confluence.
+                        Alternative option for user_agent config field.
   -f <file>            Use specified markdown file(s) for converting to html. Supports file globbing patterns (needs to be quoted).
+  --bundle <file>      Use markdown file from specified zip archive, resolving
+                        its includes and attachments within the archive.
+  --bundle-entry <path>  Path of markdown file within --bundle archive.
+                        [default: index.md]
+  --input-encoding <encoding>  Encoding of markdown files without byte order
+                        mark: utf-8 (default), utf-16le, utf-16be, latin1.
   -k                   Lock page editing to current user only to prevent accidental
                         manual edits over Confluence Web UI.
+  --lock-order <order>  Lock page editing before or after updating its
+                        contents: before, after. [default: after]
+  --author <username>  Create pages on behalf of specified user, which requires
+                        impersonation permissions. Author header takes
+                        precedence.
+  --source-updated     Store date of last git commit of the file in
+                        source-updated content property of the page.
+  --managed-banner     Add banner explaining that page is managed by mark and
+                        shouldn't be edited manually on top of the page.
   --drop-h1            Don't include H1 headings in Confluence output.
+  --attach-source      Attach source markdown file to the page.
+  --attachment-retries <n>  Retry failed uploads of attachments specified
+                        number of times. [default: 0]
+  --skip-failed-attachments  Skip attachments which are failed to upload with
+                        warning instead of exiting with error.
+  --includes-dir <dir>  Look up included templates in specified directory.
+  --attachments-dir <dir>  Resolve attachment paths against specified
+                        directory instead of current directory.
+  --keep-comments      Don't remove HTML comments from compiled page.
+  --no-replace         Don't apply find/replace rules from configuration file.
+  --show-notes         List review notes like <!-- TODO: ... --> of every file
+                        and exit without updating pages.
+  --heading-anchors    Add anchor named after heading text to every heading,
+                        so it can be linked as #<heading-slug>.
+  --heading-numbers    Prefix headings with hierarchical numbers like 1.2,
+                        starting from H2 unless configured otherwise.
+  --mentions           Convert @username references to user mentions.
+  --new-window-links   Open external links in new window, links can be
+                        limited to domains from new_window_domains config
+                        field.
+  --title-from-filename  Use file name as page title if Title header is not
+                        set, e.g. getting-started.md becomes "Getting Started".
+  --title-conflict <action>  Action to take when page with the same title
+                        is created from another file: update, fail, suffix.
+                        [default: update]
   --dry-run            Resolve page and ancestry, show resulting HTML and exit.
+  --concurrency <n>    Number of files processed in parallel. [default: 1]
+  --skip-unchanged     Don't update pages which contents are the same as
+                        contents of the page in Confluence.
+  --skip-no-metadata   Skip files without metadata instead of exiting with
+                        error, if -l is not specified.
+  --nav <file>         Use parent page IDs from specified YAML file, which maps
+                        file paths without extension or file names to IDs.
+  --folder-index       Use pages of index files like docs/index.md as parent
+                        pages of other files in their directories.
+  --meta-defaults <file>  Use headers of specified file as defaults for
+                        headers of every file.
+  --data <file>        Make variables from specified YAML file available in
+                        templates and page titles.
+  --merge-meta-lists   Add labels, watchers and attachments from file
+                        specified by --meta-defaults to ones specified in file
+                        instead of using them only if file doesn't specify any.
+  --index-page <title>  Create or update page with specified title, which
+                        links all pages updated during the run.
+  --state <file>       Record uploaded files in specified file and skip files
+                        which are not changed since they were uploaded.
   --compile-only       Show resulting HTML and don't update Confluence page content.
-  --minor-edit         Don't send notifications while updating Confluence page.
+  --html-format <format>  Format compiled page before showing or uploading
+                        it: pretty, minify.
+  --emit-stage <stage>  Show markdown after specified processing stage and
+                        exit: includes, macros, links.
+  --check-external-links  Request every external link and report links which
+                        are not available.
+  --fail-on-broken-links  Exit with error if broken external links are found.
+  --minor-edit         Don't send notifications while creating or updating
+                        Confluence page.
+  --publish            Publish pages which have Status: draft header.
+  --no-rename          Don't rename page specified by -l or PageID header to
+                        match Title header.
+  --write-back         Write ID, version and URL of updated page into headers
+                        of the file, so next runs update page with that ID.
+  --check-version      Exit with error if page was changed in Confluence
+                        since it was last updated by mark, which is detected
+                        using versions recorded in --state file or written
+                        into headers by --write-back.
+  --print-id           Print only ID of updated page instead of its URL.
+                        With --dry-run, print ID of existing page without
+                        compiling it.
+  --quiet              Show only warnings and errors, don't print page URLs.
+  --strict             Exit with error if any warnings are reported during
+                        the run. Logs are not colored in this mode.
+  --list               List pages of the space specified by --space and exit.
+  --space <key>        Space key.
+  --title <title>      Update page with specified title in space specified by
+                        option --space instead of one specified in metadata
+                        of the file.
+  --title-prefix <prefix>  List only pages which titles start with prefix.
+  --output-format <format>  Format of --list output: text, json.
+                        [default: text]
+  --dump-config        Show effective configuration with flags applied and
+                        passwords masked, then exit.
   --debug              Enable debug logs.
   --trace              Enable trace logs.
+  --trace-requests     Log every request to Confluence and its response along
+                        with their bodies, credentials are masked.
   --color <when>       Display logs in color. Possible values: auto, never.
                         [default: auto]
   -h --help            Show this screen and call 911.
@@ -83,6 +242,10 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if flags.Quiet {
+		log.SetLevel(lorg.LevelWarning)
+	}
+
 	if flags.Debug {
 		log.SetLevel(lorg.LevelDebug)
 	}
@@ -91,7 +254,7 @@ func main() {
 		log.SetLevel(lorg.LevelTrace)
 	}
 
-	if flags.Color == "never" {
+	if flags.Color == "never" || flags.Strict {
 		log.GetLogger().SetFormat(
 			lorg.NewFormat(
 				`${time:2006-01-02 15:04:05.000} ${level:%s:left:true} ${prefix}%s`,
@@ -100,17 +263,97 @@ func main() {
 		log.GetLogger().SetOutput(os.Stderr)
 	}
 
+	warnings := &Warnings{SmartOutput: lorg.NewOutput(os.Stderr)}
+	if flags.Strict {
+		log.GetLogger().SetOutput(warnings)
+	}
+
 	config, err := LoadConfig(filepath.Join(os.Getenv("HOME"), ".config/mark"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if flags.Profile != "" {
+		config, err = config.WithProfile(flags.Profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flags.DumpConfig {
+		dumpConfig(flags, config)
+		os.Exit(0)
+	}
+
 	creds, err := GetCredentials(flags, config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	api := confluence.NewAPI(creds.BaseURL, creds.Username, creds.Password)
+	headers := http.Header{}
+	for name, value := range config.Headers {
+		headers.Set(name, value)
+	}
+
+	if flags.UserAgent != "" {
+		config.UserAgent = flags.UserAgent
+	}
+
+	if config.UserAgent != "" {
+		headers.Set("User-Agent", config.UserAgent)
+	}
+
+	api := confluence.NewAPI(
+		creds.BaseURL,
+		creds.Username,
+		creds.Password,
+		headers,
+		apiOptions(flags, config),
+	)
+
+	if flags.List {
+		err := listPages(api, flags.Space, flags.TitlePrefix, flags.OutputFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if flags.Bundle != "" {
+		bundle, err := mark.ExtractBundle(flags.Bundle)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer os.RemoveAll(bundle)
+
+		// includes are looked up relative to the entry file and root of
+		// the bundle, while attachments are looked up relative to root of
+		// the bundle
+		flags.FileGlobPatten = filepath.Join(
+			bundle,
+			filepath.FromSlash(flags.BundleEntry),
+		)
+
+		if flags.IncludesDir == "" {
+			flags.IncludesDir = bundle
+		}
+
+		if flags.AttachmentsDir == "" {
+			flags.AttachmentsDir = bundle
+		}
+
+		_, err = os.Stat(flags.FileGlobPatten)
+		if err != nil {
+			log.Fatalf(
+				err,
+				"entry %q is not found in bundle %q",
+				flags.BundleEntry,
+				flags.Bundle,
+			)
+		}
+	}
 
 	files, err := filepath.Glob(flags.FileGlobPatten)
 	if err != nil {
@@ -120,30 +363,258 @@ func main() {
 		log.Fatal("No files matched")
 	}
 
-	// Loop through files matched by glob pattern
-	for _, file := range files {
-		log.Infof(
+	// all files would be uploaded to the same page
+	if flags.Title != "" && len(files) > 1 {
+		log.Fatalf(
 			nil,
-			"processing %s",
-			file,
+			"--title can be used only with single file, but %d files matched",
+			len(files),
+		)
+	}
+
+	if flags.Title != "" && creds.PageID != "" {
+		log.Fatalf(nil, "--title can't be used along with page URL")
+	}
+
+	var state *State
+	if flags.State != "" {
+		state, err = LoadState(flags.State)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var nav mark.Nav
+	if flags.Nav != "" {
+		nav, err = mark.LoadNav(flags.Nav)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flags.Data != "" {
+		data, err := includes.LoadData(flags.Data)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// variables from data file override ones from configuration file
+		includes.SetVars(data, config.Data)
+
+		config.Data = data
+	}
+
+	if flags.MetaDefaults != "" {
+		config.MetaDefaults = flags.MetaDefaults
+	}
+
+	var defaults *mark.Meta
+	if config.MetaDefaults != "" {
+		defaults, err = mark.LoadMetaDefaults(config.MetaDefaults)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flags.Concurrency < 1 {
+		log.Fatalf(nil, "concurrency should be positive number")
+	}
+
+	if flags.LockOrder != "before" && flags.LockOrder != "after" {
+		log.Fatalf(
+			nil,
+			"unexpected lock order %q, expected before or after",
+			flags.LockOrder,
+		)
+	}
+
+	if flags.HTMLFormat != "" {
+		config.HTMLFormat = flags.HTMLFormat
+	}
+
+	if flags.IncludesDir != "" {
+		config.IncludesDir = flags.IncludesDir
+	}
+
+	if flags.AttachRetries != 0 {
+		config.AttachmentRetries = flags.AttachRetries
+	}
+
+	if config.AttachmentRetries < 0 {
+		log.Fatalf(nil, "attachment retries should be non-negative number")
+	}
+
+	switch config.HTMLFormat {
+	case "", mark.HTMLFormatPretty, mark.HTMLFormatMinify:
+	default:
+		log.Fatalf(
+			nil,
+			"unexpected HTML format %q, expected %s or %s",
+			config.HTMLFormat,
+			mark.HTMLFormatPretty,
+			mark.HTMLFormatMinify,
 		)
+	}
 
-		target := processFile(file, api, flags, creds.PageID, creds.Username)
+	switch flags.TitleConflict {
+	case "update", "fail", "suffix":
+	default:
+		log.Fatalf(
+			nil,
+			"unexpected title conflict action %q, "+
+				"expected update, fail or suffix",
+			flags.TitleConflict,
+		)
+	}
 
-		log.Infof(
+	switch flags.EmitStage {
+	case "", "includes", "macros", "links":
+	default:
+		log.Fatalf(
 			nil,
-			"page successfully updated: %s",
-			creds.BaseURL+target.Links.Full,
+			"unexpected stage %q, expected includes, macros or links",
+			flags.EmitStage,
+		)
+	}
+
+	var (
+		summary Summary
+		output  sync.Mutex
+		workers sync.WaitGroup
+	)
+
+	// files are processed in groups one after another, so pages of
+	// directories are created before pages of their contents
+	groups := [][]string{files}
+
+	var folders *mark.Folders
+	if flags.FolderIndex || config.FolderIndex {
+		names := config.IndexFilenames
+		if len(names) == 0 {
+			names = mark.DefaultIndexFilenames
+		}
+
+		folders = mark.NewFolders(names)
+		groups = folders.Order(files)
+	}
+
+	for _, group := range groups {
+		queue := make(chan string)
+
+		for i := 0; i < flags.Concurrency; i++ {
+			workers.Add(1)
+
+			go func() {
+				defer workers.Done()
+
+				for file := range queue {
+					log.Infof(
+						nil,
+						"processing %s",
+						file,
+					)
+
+					target := processFile(
+						file,
+						api,
+						flags,
+						config,
+						state,
+						nav,
+						folders,
+						defaults,
+						&summary,
+						creds.PageID,
+						creds.Username,
+					)
+
+					if target == nil {
+						continue
+					}
+
+					folders.Set(file, target.ID)
+
+					summary.Update(file, target)
+
+					// IDs are machine-readable result, so they are printed
+					// in quiet mode as well
+					if flags.Quiet && !flags.PrintID {
+						continue
+					}
+
+					output.Lock()
+
+					if flags.PrintID {
+						fmt.Println(target.ID)
+					} else {
+						log.Infof(
+							nil,
+							"page successfully updated: %s",
+							creds.BaseURL+target.Links.Full,
+						)
+
+						fmt.Println(creds.BaseURL + target.Links.Full)
+					}
+
+					output.Unlock()
+				}
+			}()
+		}
+
+		// Loop through files matched by glob pattern
+		for _, file := range group {
+			queue <- file
+		}
+
+		close(queue)
+
+		workers.Wait()
+	}
+
+	if len(files) > 1 {
+		summary.Log()
+	}
+
+	if flags.IndexPage != "" && !flags.DryRun && len(summary.Pages) > 0 {
+		space := flags.Space
+		if space == "" {
+			space = config.DefaultSpace
+		}
+
+		_, err := updateIndexPage(
+			api,
+			space,
+			flags.IndexPage,
+			summary.Pages,
+			flags.MinorEdit,
 		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-		fmt.Println(creds.BaseURL + target.Links.Full)
+	if messages := warnings.Messages(); len(messages) > 0 {
+		log.Fatalf(
+			nil,
+			"%d warning(s) reported in strict mode:\n%s",
+			len(messages),
+			strings.Join(messages, "\n"),
+		)
 	}
 }
 
+var resolving sync.Mutex
+
 func processFile(
 	file string,
 	api *confluence.API,
 	flags Flags,
+	config *Config,
+	state *State,
+	nav mark.Nav,
+	folders *mark.Folders,
+	defaults *mark.Meta,
+	summary *Summary,
 	pageID string,
 	username string,
 ) *confluence.PageInfo {
@@ -152,185 +623,1438 @@ func processFile(
 		log.Fatal(err)
 	}
 
-	meta, markdown, err := mark.ExtractMeta(markdown)
-	if err != nil {
-		log.Fatal(err)
+	encoding := config.InputEncoding
+	if flags.InputEncoding != "" {
+		encoding = flags.InputEncoding
 	}
 
-	stdlib, err := stdlib.New(api)
+	markdown, err = mark.DecodeInput(markdown, encoding)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf(err, "unable to decode %s", file)
 	}
 
-	templates := stdlib.Templates
+	markers := config.NoteMarkers
+	if len(markers) == 0 {
+		markers = mark.DefaultNoteMarkers
+	}
 
-	var recurse bool
+	markdown, notes := mark.ExtractNotes(markdown, markers)
+	if flags.ShowNotes {
+		showNotes(file, notes)
 
-	for {
-		templates, markdown, recurse, err = includes.ProcessIncludes(
-			markdown,
-			templates,
-		)
-		if err != nil {
-			log.Fatal(err)
-		}
+		return nil
+	}
 
-		if !recurse {
-			break
-		}
+	if len(notes) > 0 {
+		log.Debugf(nil, "%d review note(s) removed from %s", len(notes), file)
 	}
 
-	macros, markdown, err := macro.ExtractMacros(markdown, templates)
+	meta, markdown, err := mark.ExtractMeta(markdown)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	macros = append(macros, stdlib.Macros...)
-
-	for _, macro := range macros {
-		markdown, err = macro.Apply(markdown)
-		if err != nil {
-			log.Fatal(err)
+	// page specified by --space and --title flags is updated regardless of
+	// metadata, so file doesn't need to contain any
+	if flags.Title != "" {
+		if meta == nil {
+			meta = &mark.Meta{
+				Type:                mark.TypePage,
+				Attachments:         map[string]string{},
+				OptionalAttachments: map[string]bool{},
+			}
 		}
-	}
 
-	links, err := mark.ResolveRelativeLinks(api, meta, markdown, ".")
-	if err != nil {
-		log.Fatalf(err, "unable to resolve relative links")
-	}
+		meta.Title = flags.Title
 
-	markdown = mark.SubstituteLinks(markdown, links)
+		if flags.Space != "" {
+			meta.Space = flags.Space
+		}
+	}
 
-	if flags.DryRun {
-		flags.CompileOnly = true
+	transforms := titleTransforms(flags, config)
 
-		_, _, err := mark.ResolvePage(flags.DryRun, api, meta)
-		if err != nil {
-			log.Fatalf(err, "unable to resolve page location")
+	// with titles derived from file names files don't need to contain any
+	// metadata as well
+	if meta == nil && transforms != nil && pageID == "" {
+		meta = &mark.Meta{
+			Type:                mark.TypePage,
+			Attachments:         map[string]string{},
+			OptionalAttachments: map[string]bool{},
 		}
 	}
 
-	if flags.CompileOnly {
-		fmt.Println(mark.CompileMarkdown(markdown, stdlib))
-		os.Exit(0)
+	if meta != nil {
+		meta.Merge(defaults, flags.MergeMetaLists || config.MergeMetaLists)
 	}
 
-	if pageID != "" && meta != nil {
-		log.Warning(
-			`specified file contains metadata, ` +
-				`but it will be ignored due specified command line URL`,
-		)
-
-		meta = nil
+	// attachments are resolved against their own directory, while links to
+	// other files are resolved against current directory
+	attachmentsDir := "."
+	if flags.AttachmentsDir != "" {
+		attachmentsDir = flags.AttachmentsDir
 	}
 
-	if pageID == "" && meta == nil {
-		log.Fatal(
-			`specified file doesn't contain metadata ` +
-				`and URL is not specified via command line ` +
-				`or doesn't contain pageId GET-parameter`,
-		)
+	if meta != nil && meta.AttachmentsDir != "" {
+		attachmentsDir = filepath.Join(filepath.Dir(file), meta.AttachmentsDir)
 	}
 
-	var target *confluence.PageInfo
+	// attachments which are not found in attachments directory are looked
+	// up in search paths in order
+	attachmentsDirs := append(
+		[]string{attachmentsDir},
+		config.AttachmentSearchPaths...,
+	)
 
 	if meta != nil {
-		parent, page, err := mark.ResolvePage(flags.DryRun, api, meta)
+		meta.ApplyDefaults(config.DefaultSpace, config.DefaultParent)
+		meta.AddLabels(config.DefaultLabels...)
+
+		if meta.Type != mark.TypeBlogPost {
+			if parent, ok := nav.Parent(file); ok {
+				meta.ParentID = parent
+			} else if parent, ok := folders.Parent(file); ok {
+				meta.ParentID = parent
+			}
+		}
+
+		meta.Attachments = mark.SkipMissingAttachments(
+			attachmentsDirs,
+			meta.Attachments,
+			meta.OptionalAttachments,
+		)
+
+		meta.Attachments, err = mark.ExpandAttachments(
+			attachmentsDirs,
+			meta.Attachments,
+		)
 		if err != nil {
-			log.Fatalf(
-				karma.Describe("title", meta.Title).Reason(err),
-				"unable to resolve %s",
-				meta.Type,
-			)
+			log.Fatal(err)
 		}
 
-		if page == nil {
-			page, err = api.CreatePage(
-				meta.Space,
-				meta.Type,
-				parent,
-				meta.Title,
-				``,
-			)
+		if meta.Title == "" && transforms != nil {
+			meta.Title, err = mark.TitleFromFilename(file, transforms)
 			if err != nil {
-				log.Fatalf(
-					err,
-					"can't create %s %q",
-					meta.Type,
-					meta.Title,
-				)
+				log.Fatal(err)
 			}
 		}
+	}
 
-		target = page
-	} else {
-		if pageID == "" {
-			log.Fatalf(nil, "URL should provide 'pageId' GET-parameter")
-		}
+	if pageID == "" && flags.SkipNoMeta && (meta == nil || meta.Title == "") {
+		log.Warningf(
+			nil,
+			"skipping %s: file doesn't contain metadata with page title",
+			file,
+		)
 
-		page, err := api.GetPageByID(pageID)
-		if err != nil {
-			log.Fatalf(err, "unable to retrieve page by id")
-		}
+		summary.Skip(file, "no metadata")
 
-		target = page
+		return nil
 	}
 
-	attaches, err := mark.ResolveAttachments(api, target, ".", meta.Attachments)
+	stdlib, err := stdlib.New(api)
 	if err != nil {
-		log.Fatalf(err, "unable to create/update attachments")
+		log.Fatal(err)
 	}
 
-	markdown = mark.CompileAttachmentLinks(markdown, attaches)
+	templates := stdlib.Templates
 
-	if flags.DropH1 {
-		log.Info(
-			"the leading H1 heading will be excluded from the Confluence output",
-		)
-		markdown = mark.DropDocumentLeadingH1(markdown)
+	// variables available in every template
+	vars := map[string]interface{}{
+		"BuildTime": includes.BuildTime,
+		"Git":       mark.ReadGit(file),
+		"Env":       environment(),
 	}
 
-	html := mark.CompileMarkdown(markdown, stdlib)
-
-	{
-		var buffer bytes.Buffer
+	includes.SetVars(vars, config.Data)
 
-		err := stdlib.Templates.ExecuteTemplate(
-			&buffer,
-			"ac:layout",
-			struct {
-				Layout string
-				Body   string
-			}{
-				Layout: meta.Layout,
-				Body:   html,
-			},
-		)
+	if meta != nil {
+		meta.Title, err = mark.RenderTitle(meta.Title, templates, vars)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		html = buffer.String()
 	}
 
-	err = api.UpdatePage(target, html, flags.MinorEdit, meta.Labels)
-	if err != nil {
-		log.Fatal(err)
+	// included templates are looked up relative to the file and includes
+	// directory, if they are not found relative to current directory
+	dirs := []string{filepath.Dir(file)}
+
+	if config.IncludesDir != "" {
+		dirs = append(dirs, config.IncludesDir)
 	}
 
-	if flags.EditLock {
-		log.Infof(
-			nil,
-			`edit locked on page %q by user %q to prevent manual edits`,
-			target.Title,
-			username,
-		)
+	var recurse bool
 
-		err := api.RestrictPageUpdates(target, username)
-		if err != nil {
-			log.Fatal(err)
+	for {
+		templates, markdown, recurse, err = includes.ProcessIncludes(
+			markdown,
+			templates,
+			vars,
+			dirs,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !recurse {
+			break
+		}
+	}
+
+	markdown, err = includes.ProcessEmbeds(markdown)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	header, footer := config.Prepend, config.Append
+	if meta != nil {
+		if meta.Prepend != "" {
+			header = meta.Prepend
+		}
+
+		if meta.Append != "" {
+			footer = meta.Append
+		}
+	}
+
+	markdown, err = surround(markdown, header, footer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	emitStage(flags, "includes", markdown)
+
+	macros, markdown, err := macro.ExtractMacros(markdown, templates)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	markdown, err = macro.ApplyBlockMacros(markdown, templates, vars)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	macros = append(macros, stdlib.Macros...)
+
+	for _, macro := range macros {
+		markdown, err = macro.Apply(markdown, vars)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// attachments can be specified by included templates and macros as well
+	attachments, markdown := mark.ExtractAttachmentHeaders(markdown)
+	if meta != nil && len(attachments) > 0 {
+		for _, path := range attachments {
+			meta.Attachments[path] = path
+		}
+
+		meta.Attachments, err = mark.ExpandAttachments(
+			attachmentsDirs,
+			meta.Attachments,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	emitStage(flags, "macros", markdown)
+
+	transformers, err := mark.LoadTransformers(config.Transformers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(config.Replacements) > 0 && !flags.NoReplace {
+		replacer, err := mark.NewReplacer(config.Replacements)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		transformers = append([]mark.Transformer{replacer}, transformers...)
+	}
+
+	markdown, err = mark.Transform(markdown, transformers)
+	if err != nil {
+		log.Fatalf(err, "unable to transform markdown")
+	}
+
+	markdown, err = mark.CompileRoadmaps(markdown)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	markdown, emoji := mark.CompileEmoji(markdown, config.Emoji)
+	if meta != nil {
+		for _, path := range emoji {
+			meta.Attachments[path] = path
+		}
+	}
+
+	markdown = mark.InlineReferenceLinks(markdown)
+
+	markdown = mark.ResolvePageIDLinks(api, markdown)
+
+	links, err := mark.ResolveRelativeLinks(
+		api,
+		meta,
+		markdown,
+		".",
+		transforms,
+	)
+	if err != nil {
+		log.Fatalf(err, "unable to resolve relative links")
+	}
+
+	markdown = mark.SubstituteLinks(markdown, links)
+
+	emitStage(flags, "links", markdown)
+
+	if flags.CheckLinks {
+		checkExternalLinks(markdown, flags, config)
+	}
+
+	var headingNumbers int
+	if flags.HeadingNumbers || config.HeadingNumbers {
+		headingNumbers = config.HeadingNumbersLevel
+		if headingNumbers == 0 {
+			headingNumbers = 2
+		}
+	}
+
+	newWindowDomains := config.NewWindowDomains
+	if flags.NewWindowLinks && len(newWindowDomains) == 0 {
+		newWindowDomains = []string{"*"}
+	}
+
+	// links to Confluence itself are internal regardless of domains
+	var internalDomains []string
+	if base, err := url.Parse(api.BaseURL); err == nil && base.Host != "" {
+		internalDomains = []string{base.Hostname()}
+	}
+
+	options := mark.CompileOptions{
+		HeadingAnchors: flags.HeadingAnchors,
+		Mentions:       flags.Mentions,
+		HTMLMacro:      config.HTMLMacro,
+		StrictEntities: config.StrictEntities,
+		ImageCaptions:  config.ImageCaptions,
+		EmbedMacros:    config.EmbedMacros,
+		SubSuperscript: config.SubSuperscript,
+		KeepComments:   flags.KeepComments || config.KeepComments,
+		HeadingNumbers: headingNumbers,
+
+		SmartLinkDomains: config.SmartLinkDomains,
+		NewWindowDomains: newWindowDomains,
+		InternalDomains:  internalDomains,
+		LanguageAliases:  config.LanguageAliases,
+		WideTableColumns: config.WideTableColumns,
+		AllowedMacros:    config.AllowedMacros,
+		DeniedMacros:     config.DeniedMacros,
+	}
+
+	var checksum string
+	if state != nil && !flags.DryRun && !flags.CompileOnly {
+		checksum, err = getChecksum(markdown, meta, attachmentsDirs)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if state.Unchanged(stateKey(file, flags.Bundle), checksum) {
+			log.Infof(
+				nil,
+				"skipping %s: not changed since it was uploaded",
+				file,
+			)
+
+			rememberFolder(folders, state, file, stateKey(file, flags.Bundle))
+
+			summary.Skip(file, "not changed")
+
+			return nil
+		}
+	}
+
+	if flags.DryRun {
+		flags.CompileOnly = true
+
+		_, page, err := mark.ResolvePage(flags.DryRun, api, meta)
+		if err != nil {
+			log.Fatalf(err, "unable to resolve page location")
+		}
+
+		if flags.PrintID {
+			if page == nil {
+				log.Warningf(nil, "page for %s doesn't exist yet", file)
+			}
+
+			return page
+		}
+	}
+
+	if flags.CompileOnly {
+		html, err := mark.FormatHTML(
+			mark.CompileMarkdown(markdown, stdlib, options),
+			config.HTMLFormat,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(html)
+		os.Exit(0)
+	}
+
+	// page specified by command line URL is renamed to match title from
+	// metadata, which is the only header that is not ignored in that case
+	var title string
+
+	if pageID != "" && meta != nil {
+		log.Warning(
+			`specified file contains metadata, ` +
+				`but it will be ignored due specified command line URL`,
+		)
+
+		title = meta.Title
+		meta = nil
+	}
+
+	if pageID == "" && meta == nil {
+		log.Fatal(
+			`specified file doesn't contain metadata ` +
+				`and URL is not specified via command line ` +
+				`or doesn't contain pageId GET-parameter`,
+		)
+	}
+
+	var target *confluence.PageInfo
+
+	if meta != nil {
+		// files processed concurrently can share missing parents, which
+		// should be created only once
+		resolving.Lock()
+
+		parent, page, err := mark.ResolvePage(flags.DryRun, api, meta)
+		if err != nil {
+			log.Fatalf(
+				karma.Describe("title", meta.Title).Reason(err),
+				"unable to resolve %s",
+				meta.Type,
+			)
+		}
+
+		if page != nil && meta.PageID == "" && flags.TitleConflict != "update" {
+			parent, page = resolveTitleConflict(
+				api,
+				flags,
+				config,
+				meta,
+				file,
+				parent,
+				page,
+			)
+		}
+
+		if page == nil {
+			// pages are archived after their contents are updated
+			status := meta.Status
+			if status == mark.StatusArchived {
+				status = ""
+			}
+
+			author := flags.Author
+			if meta.Author != "" {
+				author = meta.Author
+			}
+
+			page, err = api.CreatePageAs(
+				meta.Space,
+				meta.Type,
+				parent,
+				meta.Title,
+				status,
+				``,
+				flags.MinorEdit,
+				findAuthor(api, author),
+			)
+			if err != nil {
+				log.Fatalf(
+					err,
+					"can't create %s %q",
+					meta.Type,
+					meta.Title,
+				)
+			}
+
+			if flags.TitleConflict != "update" {
+				setSourcePath(api, page, file)
+			}
+		}
+
+		resolving.Unlock()
+
+		// page pinned by PageID header is renamed like page specified by
+		// command line URL
+		if meta.PageID != "" {
+			mark.RenamePage(page, renameTitle(flags, meta.Title))
+		}
+
+		target = page
+	} else {
+		if pageID == "" {
+			log.Fatalf(nil, "URL should provide 'pageId' GET-parameter")
+		}
+
+		page, err := mark.ResolvePageByID(
+			api,
+			pageID,
+			renameTitle(flags, title),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		target = page
+	}
+
+	// metadata is ignored for page specified by command line URL
+	var (
+		replacements map[string]string
+		labels       []string
+		layout       string
+	)
+
+	if meta != nil {
+		media := mark.ExtractMediaAttachments(markdown, attachmentsDirs)
+		for _, path := range media {
+			meta.Attachments[path] = path
+		}
+
+		replacements = meta.Attachments
+		labels = meta.Labels
+		layout = meta.Layout
+	}
+
+	policy := mark.AttachmentPolicy{
+		Retries: config.AttachmentRetries,
+		Skip:    flags.SkipFailed || config.SkipFailedAttachments,
+	}
+
+	attaches, err := mark.ResolveAttachments(
+		api,
+		target,
+		attachmentsDirs,
+		replacements,
+		policy,
+	)
+	if err != nil {
+		log.Fatalf(err, "unable to create/update attachments")
+	}
+
+	// skipped attachments are uploaded on next run, so the file shouldn't
+	// be recorded as unchanged
+	skipped := hasSkippedAttachments(attaches)
+
+	if config.DocumentLinks {
+		markdown = mark.LinkDocuments(markdown)
+	}
+
+	markdown = mark.CompileAttachmentLinks(markdown, attaches)
+
+	// remaining attachment:// links reference attachments of other pages
+	space := config.DefaultSpace
+	if flags.Space != "" {
+		space = flags.Space
+	}
+
+	if meta != nil {
+		space = meta.Space
+	}
+
+	markdown = mark.ResolvePageAttachments(api, space, markdown)
+
+	if flags.AttachSource {
+		// source file is not referenced in the page, so its links are not
+		// compiled
+		name := filepath.Base(file)
+
+		source, err := mark.ResolveAttachments(
+			api,
+			target,
+			[]string{filepath.Dir(file)},
+			map[string]string{name: name},
+			policy,
+		)
+		if err != nil {
+			log.Fatalf(err, "unable to attach source file")
+		}
+
+		skipped = skipped || hasSkippedAttachments(source)
+	}
+
+	if flags.DropH1 {
+		log.Info(
+			"the leading H1 heading will be excluded from the Confluence output",
+		)
+		markdown = mark.DropDocumentLeadingH1(markdown)
+	}
+
+	html := mark.CompileMarkdown(markdown, stdlib, options)
+
+	if flags.ManagedBanner || config.ManagedBanner {
+		text := config.ManagedBannerText
+		if text == "" {
+			text = mark.DefaultManagedBanner
+		}
+
+		html = mark.AddManagedBanner(html, text)
+	}
+
+	{
+		var buffer bytes.Buffer
+
+		err := stdlib.Templates.ExecuteTemplate(
+			&buffer,
+			"ac:layout",
+			struct {
+				Layout    string
+				Body      string
+				BuildTime time.Time
+				Git       mark.Git
+			}{
+				Layout:    layout,
+				Body:      html,
+				BuildTime: includes.BuildTime,
+				Git:       vars["Git"].(mark.Git),
+			},
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		html = buffer.String()
+	}
+
+	html, err = mark.FormatHTML(html, config.HTMLFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = mark.CheckPageSize(html, config.PageSizeLimit)
+	if err != nil {
+		// with --strict the page is not uploaded at all, because Confluence
+		// rejects too large pages with unclear error
+		if flags.Strict {
+			log.Fatalf(err, "page for %s is too large", file)
+		}
+
+		log.Warningf(err, "page for %s is too large", file)
+	}
+
+	var status string
+	if meta != nil {
+		status = meta.Status
+	}
+
+	if flags.Publish {
+		status = mark.StatusCurrent
+	}
+
+	if flags.SkipUnchanged {
+		normalizations := config.CompareNormalize
+		if normalizations == nil {
+			normalizations = mark.DefaultNormalizations
+		}
+
+		current, err := api.GetPageContents(target)
+		if err != nil {
+			log.Fatalf(err, "unable to retrieve page contents")
+		}
+
+		same, err := mark.SameHTML(html, current.Body, normalizations)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// title, labels and status are updated along with contents, so page
+		// is skipped only if none of them are changed
+		if same && pageUnchanged(target, current, labels, status) {
+			log.Infof(
+				nil,
+				"skipping %s: page contents are not changed",
+				file,
+			)
+
+			// pages of new files in the directory of skipped index file
+			// are created under its page anyway
+			folders.Set(file, target.ID)
+
+			summary.Skip(file, "not changed")
+
+			return nil
+		}
+	}
+
+	if flags.CheckVersion {
+		err := checkVersion(
+			stateKey(file, flags.Bundle),
+			meta,
+			state,
+			target,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flags.EditLock && flags.LockOrder == "before" {
+		editLock(api, target, username)
+	}
+
+	switch {
+	case status == mark.StatusArchived &&
+		target.Status == mark.StatusArchived:
+		log.Infof(nil, "skipping %s: page is archived", file)
+
+		summary.Skip(file, "archived")
+
+		return nil
+
+	case status == mark.StatusArchived:
+		// page is archived after its contents are updated
+		status = ""
+
+	case target.Status == mark.StatusArchived:
+		log.Infof(nil, "restoring archived page %q", target.Title)
+
+		status = mark.StatusCurrent
+	}
+
+	err = api.UpdatePage(target, html, flags.MinorEdit, labels, status)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if meta != nil && meta.Status == mark.StatusArchived {
+		err := api.ArchivePage(target.ID)
+		if err != nil {
+			log.Warningf(
+				err,
+				"unable to archive page %q, archiving is supported "+
+					"only by Confluence Cloud",
+				target.Title,
+			)
+		} else {
+			log.Infof(nil, "archived page %q", target.Title)
+		}
+	}
+
+	if meta != nil && meta.Appearance != "" {
+		for _, key := range []string{
+			"content-appearance-published",
+			"content-appearance-draft",
+		} {
+			err := api.SetContentProperty(target.ID, key, meta.Appearance)
+			if err != nil {
+				log.Fatalf(err, "unable to set page appearance")
+			}
+		}
+	}
+
+	if flags.SourceUpdated || config.SourceUpdated {
+		updated, err := mark.SourceUpdated(file)
+		if err != nil {
+			log.Fatalf(err, "unable to read last change date of %s", file)
+		}
+
+		err = api.SetContentProperty(
+			target.ID,
+			mark.SourceUpdatedProperty,
+			updated.Format(time.RFC3339),
+		)
+		if err != nil {
+			log.Fatalf(err, "unable to set source update date")
+		}
+	}
+
+	if meta != nil {
+		addWatchers(api, target, meta.Watchers)
+	}
+
+	if meta != nil && len(meta.RenameFrom) > 0 {
+		createRedirects(
+			api,
+			target,
+			meta,
+			config.RedirectMacro,
+			flags.MinorEdit,
+		)
+	}
+
+	if flags.WriteBack {
+		err := writeBack(file, target, api.BaseURL, encoding)
+		if err != nil {
+			log.Fatalf(err, "unable to write page headers to %s", file)
+		}
+	}
+
+	if flags.EditLock && flags.LockOrder == "after" {
+		editLock(api, target, username)
+	}
+
+	if state != nil {
+		// empty checksum never matches, while page is still recorded for
+		// --check-version and folder pages
+		if skipped {
+			checksum = ""
+		}
+
+		err := state.Update(stateKey(file, flags.Bundle), StateEntry{
+			Checksum: checksum,
+			PageID:   target.ID,
+			Version:  target.Version.Number + 1,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return target
+}
+
+// resolveTitleConflict checks that found page is created from the same
+// file, pages without recorded source are considered to be created from it.
+// Otherwise, it exits or looks up page with suffixed title, depending on
+// --title-conflict action.
+func resolveTitleConflict(
+	api *confluence.API,
+	flags Flags,
+	config *Config,
+	meta *mark.Meta,
+	file string,
+	parent *confluence.PageInfo,
+	page *confluence.PageInfo,
+) (*confluence.PageInfo, *confluence.PageInfo) {
+	suffix := config.TitleConflictSuffix
+	if suffix == "" {
+		suffix = " (%d)"
+	}
+
+	title := meta.Title
+
+	for number := 2; page != nil; number++ {
+		var source string
+
+		found, err := api.GetContentProperty(
+			page.ID,
+			mark.SourcePathProperty,
+			&source,
+		)
+		if err != nil {
+			log.Fatalf(err, "unable to read source of page %q", page.Title)
+		}
+
+		if !found || source == mark.SourcePath(file) {
+			if !found {
+				setSourcePath(api, page, file)
+			}
+
+			return parent, page
+		}
+
+		// suffix without number can be appended only once
+		if flags.TitleConflict == "fail" ||
+			(number > 2 && !strings.Contains(suffix, "%d")) {
+			log.Fatalf(
+				nil,
+				"page %q is already created from %s, not from %s",
+				page.Title,
+				source,
+				mark.SourcePath(file),
+			)
+		}
+
+		meta.Title = title + suffix
+		if strings.Contains(suffix, "%d") {
+			meta.Title = title + fmt.Sprintf(suffix, number)
+		}
+
+		log.Warningf(
+			nil,
+			"page %q is already created from %s, using title %q for %s",
+			page.Title,
+			source,
+			meta.Title,
+			file,
+		)
+
+		parent, page, err = mark.ResolvePage(flags.DryRun, api, meta)
+		if err != nil {
+			log.Fatalf(
+				karma.Describe("title", meta.Title).Reason(err),
+				"unable to resolve %s",
+				meta.Type,
+			)
 		}
 	}
 
-	return target
+	return parent, page
+}
+
+// setSourcePath records file the page is created from, so pages with the
+// same title created from different files can be told apart.
+func setSourcePath(
+	api *confluence.API,
+	page *confluence.PageInfo,
+	file string,
+) {
+	err := api.SetContentProperty(
+		page.ID,
+		mark.SourcePathProperty,
+		mark.SourcePath(file),
+	)
+	if err != nil {
+		log.Fatalf(err, "unable to set source of page %q", page.Title)
+	}
+}
+
+// createRedirects creates or updates pages at previous titles of renamed
+// page, which point to the page. Existing pages which are not created as
+// redirects are left intact.
+func createRedirects(
+	api *confluence.API,
+	page *confluence.PageInfo,
+	meta *mark.Meta,
+	macro bool,
+	minorEdit bool,
+) {
+	if meta.Type == mark.TypeBlogPost {
+		log.Warningf(nil, "redirects are not supported for blog posts")
+
+		return
+	}
+
+	var parent *confluence.PageInfo
+	if len(page.Ancestors) > 0 {
+		ancestor := page.Ancestors[len(page.Ancestors)-1]
+
+		parent = &confluence.PageInfo{ID: ancestor.Id, Title: ancestor.Title}
+	}
+
+	body := mark.RenderRedirect(meta.Space, page.Title, macro)
+
+	for _, title := range meta.RenameFrom {
+		if title == page.Title {
+			continue
+		}
+
+		redirect, err := api.FindPage(meta.Space, title, mark.TypePage)
+		if err != nil {
+			log.Fatalf(err, "unable to find page %q", title)
+		}
+
+		if redirect == nil {
+			log.Infof(nil, "creating redirect page %q", title)
+
+			redirect, err = api.CreatePage(
+				meta.Space,
+				mark.TypePage,
+				parent,
+				title,
+				"",
+				body,
+				minorEdit,
+			)
+			if err != nil {
+				log.Fatalf(err, "unable to create redirect page %q", title)
+			}
+
+			err = api.SetContentProperty(
+				redirect.ID,
+				mark.RedirectProperty,
+				page.ID,
+			)
+			if err != nil {
+				log.Fatalf(err, "unable to mark page %q as redirect", title)
+			}
+
+			continue
+		}
+
+		var target string
+
+		ok, err := api.GetContentProperty(
+			redirect.ID,
+			mark.RedirectProperty,
+			&target,
+		)
+		if err != nil {
+			log.Fatalf(err, "unable to read properties of page %q", title)
+		}
+
+		if !ok || target != page.ID {
+			log.Warningf(
+				nil,
+				"page %q already exists and is not a redirect to %q, "+
+					"redirect is not created",
+				title,
+				page.Title,
+			)
+
+			continue
+		}
+
+		existing, err := api.GetPageBody(redirect.ID)
+		if err != nil {
+			log.Fatalf(err, "unable to retrieve contents of page %q", title)
+		}
+
+		same, err := mark.SameHTML(body, existing, mark.DefaultNormalizations)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if same {
+			continue
+		}
+
+		err = api.UpdatePage(redirect, body, minorEdit, nil, "")
+		if err != nil {
+			log.Fatalf(err, "unable to update redirect page %q", title)
+		}
+	}
+}
+
+// surround adds contents of header and footer files before and after
+// markdown respectively.
+func surround(markdown []byte, header string, footer string) ([]byte, error) {
+	read := func(path string) ([]byte, error) {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, karma.Format(err, "unable to read file: %q", path)
+		}
+
+		return bytes.TrimRight(contents, "\n"), nil
+	}
+
+	parts := [][]byte{}
+
+	if header != "" {
+		contents, err := read(header)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, contents)
+	}
+
+	parts = append(parts, markdown)
+
+	if footer != "" {
+		contents, err := read(footer)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, contents)
+	}
+
+	return bytes.Join(parts, []byte("\n\n")), nil
+}
+
+// emitStage prints markdown and exits if --emit-stage is the given stage.
+func emitStage(flags Flags, stage string, markdown []byte) {
+	if flags.EmitStage != stage {
+		return
+	}
+
+	fmt.Println(string(markdown))
+	os.Exit(0)
+}
+
+// environment returns environment variables as map, which is available in
+// templates as .Env.
+func environment() map[string]string {
+	variables := map[string]string{}
+
+	for _, variable := range os.Environ() {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 {
+			variables[parts[0]] = parts[1]
+		}
+	}
+
+	return variables
+}
+
+// showNotes prints review notes of the file, each on its own line.
+func showNotes(file string, notes []mark.Note) {
+	var buffer strings.Builder
+
+	for _, note := range notes {
+		fmt.Fprintf(
+			&buffer,
+			"%s:%d: %s: %s\n",
+			file,
+			note.Line,
+			note.Marker,
+			strings.Join(strings.Fields(note.Text), " "),
+		)
+	}
+
+	fmt.Print(buffer.String())
+}
+
+// editLock restricts page editing to specified user only.
+func editLock(api *confluence.API, page *confluence.PageInfo, username string) {
+	log.Infof(
+		nil,
+		`edit locked on page %q by user %q to prevent manual edits`,
+		page.Title,
+		username,
+	)
+
+	err := api.RestrictPageUpdates(page, username)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// findAuthor returns user with given username, which page is created on
+// behalf of, or nil if username is empty or user is not found.
+func findAuthor(api *confluence.API, username string) *confluence.User {
+	if username == "" {
+		return nil
+	}
+
+	user, err := api.GetUserByUsername(username)
+	if err != nil {
+		log.Fatalf(err, "unable to find author %q", username)
+	}
+
+	if user == nil {
+		log.Warningf(
+			nil,
+			"user %q is not found, page is created by current user",
+			username,
+		)
+	}
+
+	return user
+}
+
+// addWatchers makes users with given usernames watch the page, users which
+// are not found are reported, but don't fail the update.
+func addWatchers(
+	api *confluence.API,
+	page *confluence.PageInfo,
+	usernames []string,
+) {
+	for _, username := range usernames {
+		user, err := api.GetUserByUsername(username)
+		if err != nil {
+			log.Fatalf(err, "unable to find watcher %q", username)
+		}
+
+		if user == nil {
+			log.Warningf(
+				nil,
+				"user %q is not found and is not added as watcher",
+				username,
+			)
+
+			continue
+		}
+
+		added, err := api.AddWatcher(page.ID, user)
+		if err != nil {
+			log.Fatalf(err, "unable to add watcher %q", username)
+		}
+
+		if added {
+			log.Infof(nil, "added watcher: %s", username)
+		}
+	}
+}
+
+// renameTitle returns title which page found by ID is renamed to, it's empty
+// with --no-rename, so the page keeps its title.
+func renameTitle(flags Flags, title string) string {
+	if flags.NoRename {
+		return ""
+	}
+
+	return title
+}
+
+// titleTransforms returns transforms for deriving page titles from file
+// names, or nil if titles are not derived, see mark.TitleFromFilename.
+func titleTransforms(flags Flags, config *Config) []string {
+	if !flags.TitleFromFile && !config.TitleFromFilename {
+		return nil
+	}
+
+	if len(config.TitleTransforms) == 0 {
+		return []string{"spaces", "title"}
+	}
+
+	return config.TitleTransforms
+}
+
+// pageUnchanged reports whether title, labels and status of the page in
+// Confluence are the same as ones which would be set by its update.
+func pageUnchanged(
+	target *confluence.PageInfo,
+	current *confluence.PageContents,
+	labels []string,
+	status string,
+) bool {
+	if current.Title != target.Title {
+		return false
+	}
+
+	if status != "" && status != current.Status {
+		return false
+	}
+
+	existing := map[string]bool{}
+	for _, label := range current.Labels {
+		existing[label] = true
+	}
+
+	for _, label := range labels {
+		if label != "" && !existing[label] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeBack writes ID, version and URL of updated page into headers of the
+// file, keeping its encoding.
+func writeBack(
+	file string,
+	page *confluence.PageInfo,
+	baseURL string,
+	encoding string,
+) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	original, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	contents, err := mark.DecodeInput(original, encoding)
+	if err != nil {
+		return err
+	}
+
+	contents = mark.WriteBackHeaders(
+		contents,
+		page.ID,
+		page.Version.Number+1,
+		baseURL+page.Links.Full,
+	)
+
+	contents, err = mark.EncodeOutput(contents, original, encoding)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, contents, info.Mode())
+}
+
+// checkVersion checks that page was not changed in Confluence since the file
+// was last uploaded to it. Expected version is taken from the state file or,
+// for files not recorded there, from Version header written by --write-back.
+func checkVersion(
+	file string,
+	meta *mark.Meta,
+	state *State,
+	page *confluence.PageInfo,
+) error {
+	var expected int64
+	if state != nil {
+		expected = state.Version(file, page.ID)
+	}
+
+	if expected == 0 && meta != nil && meta.PageID == page.ID {
+		expected = meta.Version
+	}
+
+	if expected == 0 {
+		log.Debugf(nil, "no recorded version of page %q for %s", page.ID, file)
+
+		return nil
+	}
+
+	if page.Version.Number != expected {
+		return fmt.Errorf(
+			"page %q was changed in Confluence since %s was uploaded: "+
+				"version is %d, expected %d",
+			page.Title,
+			file,
+			page.Version.Number,
+			expected,
+		)
+	}
+
+	return nil
+}
+
+// dumpConfig prints configuration merged with flags, which override its
+// fields. Credentials which can't be resolved are reported, but configuration
+// is printed anyway.
+func dumpConfig(flags Flags, config *Config) {
+	dump := *config
+
+	creds, err := GetCredentials(flags, config)
+	if err != nil {
+		log.Warning(err)
+	} else {
+		dump.Username = creds.Username
+		dump.Password = creds.Password
+		dump.BaseURL = creds.BaseURL
+	}
+
+	if flags.UserAgent != "" {
+		dump.UserAgent = flags.UserAgent
+	}
+
+	if flags.InputEncoding != "" {
+		dump.InputEncoding = flags.InputEncoding
+	}
+
+	if flags.IncludesDir != "" {
+		dump.IncludesDir = flags.IncludesDir
+	}
+
+	if flags.Space != "" {
+		dump.DefaultSpace = flags.Space
+	}
+
+	dump.KeepComments = dump.KeepComments || flags.KeepComments
+
+	err = dump.Dump(os.Stdout)
+	if err != nil {
+		log.Fatalf(err, "unable to dump configuration")
+	}
+}
+
+// apiOptions returns options of Confluence API client, which are tuned for
+// bulk uploads unless specified in configuration file.
+func apiOptions(flags Flags, config *Config) confluence.Options {
+	seconds := func(value int, fallback int) time.Duration {
+		if value == 0 {
+			value = fallback
+		}
+
+		return time.Duration(value) * time.Second
+	}
+
+	connections := config.MaxIdleConnections
+	if connections == 0 {
+		connections = 16
+	}
+
+	return confluence.Options{
+		TraceRequests: flags.TraceRequests,
+
+		DialTimeout:           seconds(config.DialTimeout, 30),
+		ResponseHeaderTimeout: seconds(config.ResponseTimeout, 300),
+		KeepAlive:             seconds(config.KeepAlive, 30),
+		MaxIdleConns:          connections,
+	}
+}
+
+func checkExternalLinks(markdown []byte, flags Flags, config *Config) {
+	timeout := config.LinkCheckTimeout
+	if timeout == 0 {
+		timeout = 10
+	}
+
+	concurrency := config.LinkCheckConcurrency
+	if concurrency == 0 {
+		concurrency = 4
+	}
+
+	broken := mark.CheckExternalLinks(markdown, mark.LinkCheckOptions{
+		Concurrency: concurrency,
+		Timeout:     time.Duration(timeout) * time.Second,
+		SkipDomains: config.LinkCheckSkipDomains,
+	})
+
+	for _, link := range broken {
+		log.Warningf(nil, "broken external link: %s: %s", link.URL, link.Reason)
+	}
+
+	if len(broken) > 0 && flags.BrokenLinksErr {
+		log.Fatalf(nil, "%d broken external link(s) found", len(broken))
+	}
+}
+
+// Summary collects results of processing multiple files, which are reported
+// at the end of the run.
+type Summary struct {
+	Updated []string
+	Skipped []SkippedFile
+
+	// Pages are updated pages by their files.
+	Pages map[string]*confluence.PageInfo
+
+	mutex sync.Mutex
+}
+
+type SkippedFile struct {
+	File   string
+	Reason string
+}
+
+func (summary *Summary) Update(file string, page *confluence.PageInfo) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+
+	if summary.Pages == nil {
+		summary.Pages = map[string]*confluence.PageInfo{}
+	}
+
+	summary.Updated = append(summary.Updated, file)
+	summary.Pages[file] = page
+}
+
+func (summary *Summary) Skip(file string, reason string) {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+
+	summary.Skipped = append(summary.Skipped, SkippedFile{file, reason})
+}
+
+// Log reports summary, files are sorted by name, so order doesn't depend on
+// the order in which files were processed.
+func (summary *Summary) Log() {
+	summary.mutex.Lock()
+	defer summary.mutex.Unlock()
+
+	sort.Strings(summary.Updated)
+	sort.Slice(summary.Skipped, func(i, j int) bool {
+		return summary.Skipped[i].File < summary.Skipped[j].File
+	})
+
+	log.Infof(
+		nil,
+		"%d file(s) processed: %d updated, %d skipped",
+		len(summary.Updated)+len(summary.Skipped),
+		len(summary.Updated),
+		len(summary.Skipped),
+	)
+
+	for _, skipped := range summary.Skipped {
+		log.Infof(nil, "skipped %s: %s", skipped.File, skipped.Reason)
+	}
 }
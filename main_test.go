@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/pkg/confluence"
+	"github.com/kovetskiy/mark/pkg/mark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageUnchanged(t *testing.T) {
+	test := assert.New(t)
+
+	target := &confluence.PageInfo{Title: "Page"}
+
+	current := &confluence.PageContents{
+		Title:  "Page",
+		Status: mark.StatusDraft,
+		Labels: []string{"a", "b"},
+	}
+
+	testcases := []struct {
+		title     string
+		labels    []string
+		status    string
+		unchanged bool
+	}{
+		{"Page", []string{"a"}, "", true},
+		{"Page", []string{"b", "a", ""}, mark.StatusDraft, true},
+		{"Renamed", []string{"a"}, "", false},
+		{"Page", []string{"a", "c"}, "", false},
+		{"Page", nil, mark.StatusCurrent, false},
+	}
+
+	for _, testcase := range testcases {
+		target.Title = testcase.title
+
+		test.Equal(
+			testcase.unchanged,
+			pageUnchanged(target, current, testcase.labels, testcase.status),
+			testcase,
+		)
+	}
+}
+
+func TestRenameTitle(t *testing.T) {
+	test := assert.New(t)
+
+	page := &confluence.PageInfo{Title: "Old"}
+
+	mark.RenamePage(page, renameTitle(Flags{NoRename: true}, "New"))
+	test.Equal("Old", page.Title)
+
+	mark.RenamePage(page, renameTitle(Flags{}, ""))
+	test.Equal("Old", page.Title)
+
+	mark.RenamePage(page, renameTitle(Flags{}, "New"))
+	test.Equal("New", page.Title)
+}
+
+func TestSurround(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	header := filepath.Join(dir, "header.md")
+	footer := filepath.Join(dir, "footer.md")
+
+	test.NoError(ioutil.WriteFile(header, []byte("# Header\n\n\n"), 0644))
+	test.NoError(ioutil.WriteFile(footer, []byte("Footer\n"), 0644))
+
+	testcases := []struct {
+		header   string
+		footer   string
+		expected string
+	}{
+		{"", "", "Body"},
+		{header, "", "# Header\n\nBody"},
+		{"", footer, "Body\n\nFooter"},
+		{header, footer, "# Header\n\nBody\n\nFooter"},
+	}
+
+	for _, testcase := range testcases {
+		markdown, err := surround(
+			[]byte("Body"),
+			testcase.header,
+			testcase.footer,
+		)
+		test.NoError(err)
+		test.Equal(testcase.expected, string(markdown), testcase)
+	}
+
+	for _, missing := range [][2]string{
+		{filepath.Join(dir, "missing.md"), footer},
+		{header, filepath.Join(dir, "missing.md")},
+	} {
+		_, err := surround([]byte("Body"), missing[0], missing[1])
+		test.Error(err)
+		test.Contains(err.Error(), "missing.md")
+	}
+}
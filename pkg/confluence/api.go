@@ -7,9 +7,12 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/textproto"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/kovetskiy/gopencils"
 	"github.com/kovetskiy/lorg"
@@ -19,6 +22,8 @@ import (
 
 type User struct {
 	AccountID string `json:"accountId"`
+	UserKey   string `json:"userKey"`
+	Username  string `json:"username"`
 }
 
 type API struct {
@@ -31,9 +36,10 @@ type API struct {
 }
 
 type PageInfo struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
-	Type  string `json:"type"`
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
 
 	Version struct {
 		Number int64 `json:"number"`
@@ -61,6 +67,8 @@ type AttachmentInfo struct {
 	} `json:"_links"`
 }
 
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 type form struct {
 	buffer io.Reader
 	writer *multipart.Writer
@@ -74,13 +82,172 @@ func (tracer *tracer) Printf(format string, args ...interface{}) {
 	log.Tracef(nil, tracer.prefix+" "+format, args...)
 }
 
-func NewAPI(baseURL string, username string, password string) *API {
+// headerTransport adds headers to every request, which is required by some
+// API gateways.
+type headerTransport struct {
+	headers   http.Header
+	transport http.RoundTripper
+}
+
+func (transport *headerTransport) RoundTrip(
+	request *http.Request,
+) (*http.Response, error) {
+	request = request.Clone(request.Context())
+
+	for name, values := range transport.headers {
+		request.Header[name] = values
+	}
+
+	return transport.transport.RoundTrip(request)
+}
+
+// traceTransport logs every request and response along with their bodies,
+// credentials are masked.
+type traceTransport struct {
+	transport http.RoundTripper
+}
+
+func (transport *traceTransport) RoundTrip(
+	request *http.Request,
+) (*http.Response, error) {
+	body, err := traceBody(&request.Body, request.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof(
+		nil,
+		"request: %s %s\n%s%s",
+		request.Method,
+		request.URL,
+		traceHeaders(request.Header),
+		body,
+	)
+
+	response, err := transport.transport.RoundTrip(request)
+	if err != nil {
+		log.Infof(
+			nil,
+			"response: %s %s: %s",
+			request.Method,
+			request.URL,
+			err,
+		)
+
+		return nil, err
+	}
+
+	body, err = traceBody(&response.Body, response.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof(
+		nil,
+		"response: %s %s: %s\n%s%s",
+		request.Method,
+		request.URL,
+		response.Status,
+		traceHeaders(response.Header),
+		body,
+	)
+
+	return response, nil
+}
+
+// traceHeaders formats headers masking credentials.
+func traceHeaders(headers http.Header) string {
+	masked := headers.Clone()
+
+	for _, name := range []string{"Authorization", "Cookie", "Set-Cookie"} {
+		if masked.Get(name) != "" {
+			masked.Set(name, "<masked>")
+		}
+	}
+
+	var buffer bytes.Buffer
+
+	masked.Write(&buffer)
+
+	return buffer.String()
+}
+
+// traceBody reads body and replaces it with a copy, so it can be read again.
+// Contents of uploaded files are not returned.
+func traceBody(body *io.ReadCloser, headers http.Header) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+
+	if strings.HasPrefix(headers.Get("Content-Type"), "multipart/") {
+		return "\n<multipart data>", nil
+	}
+
+	contents, err := ioutil.ReadAll(*body)
+	if err != nil {
+		return "", err
+	}
+
+	(*body).Close()
+
+	*body = ioutil.NopCloser(bytes.NewReader(contents))
+
+	return "\n" + string(contents), nil
+}
+
+// Options configures HTTP client of Confluence API. Zero values leave
+// defaults of Go HTTP client as is.
+type Options struct {
+	// TraceRequests makes every request and response logged.
+	TraceRequests bool
+
+	// DialTimeout limits time of establishing connection.
+	DialTimeout time.Duration
+
+	// ResponseHeaderTimeout limits time of waiting for response after
+	// request is written, including uploaded files.
+	ResponseHeaderTimeout time.Duration
+
+	// KeepAlive is a period of TCP keep-alive probes of open connections.
+	KeepAlive time.Duration
+
+	// MaxIdleConns limits number of idle connections kept open for reuse.
+	MaxIdleConns int
+}
+
+// NewAPI creates Confluence API client, which sends given headers with every
+// request, e.g. User-Agent.
+func NewAPI(
+	baseURL string,
+	username string,
+	password string,
+	headers http.Header,
+	options Options,
+) *API {
+	// base URL can include context path like https://example.com/wiki, and
+	// is sometimes specified as URL of REST API itself
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	baseURL = strings.TrimSuffix(baseURL, "/rest/api")
+
 	auth := &gopencils.BasicAuth{username, password}
 
-	rest := gopencils.Api(baseURL+"/rest/api", auth)
+	var transport http.RoundTripper = newTransport(options)
+	if options.TraceRequests {
+		transport = &traceTransport{transport: transport}
+	}
+
+	client := &http.Client{
+		Transport: &headerTransport{
+			headers:   headers,
+			transport: transport,
+		},
+	}
+
+	rest := gopencils.Api(baseURL+"/rest/api", auth, client)
 	json := gopencils.Api(
 		baseURL+"/rpc/json-rpc/confluenceservice-v2",
 		auth,
+		client,
 	)
 
 	if log.GetLevel() == lorg.LevelTrace {
@@ -91,8 +258,37 @@ func NewAPI(baseURL string, username string, password string) *API {
 	return &API{
 		rest:    rest,
 		json:    json,
-		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		BaseURL: baseURL,
+	}
+}
+
+func newTransport(options Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
 	}
+
+	if options.DialTimeout > 0 {
+		dialer.Timeout = options.DialTimeout
+	}
+
+	if options.KeepAlive > 0 {
+		dialer.KeepAlive = options.KeepAlive
+	}
+
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = options.ResponseHeaderTimeout
+
+	// all requests are sent to the same host, so idle connections are not
+	// limited per host
+	if options.MaxIdleConns > 0 {
+		transport.MaxIdleConns = options.MaxIdleConns
+		transport.MaxIdleConnsPerHost = options.MaxIdleConns
+	}
+
+	return transport
 }
 
 func (api *API) FindRootPage(space string) (*PageInfo, error) {
@@ -122,7 +318,86 @@ func (api *API) FindRootPage(space string) (*PageInfo, error) {
 	}, nil
 }
 
+// ListPages returns all pages of the space with their ancestors, requesting
+// them page by page. Confluence can return fewer pages than requested, so
+// pages are requested until there is no link to the next ones.
+func (api *API) ListPages(space string) ([]PageInfo, error) {
+	const limit = 100
+
+	pages := []PageInfo{}
+
+	for start := 0; ; {
+		result := struct {
+			Results []PageInfo `json:"results"`
+			Size    int        `json:"size"`
+			Links   struct {
+				Next string `json:"next"`
+			} `json:"_links"`
+		}{}
+
+		request, err := api.rest.Res(
+			"content/", &result,
+		).Get(map[string]string{
+			"spaceKey": space,
+			"type":     "page",
+			"expand":   "ancestors,version",
+			"start":    fmt.Sprint(start),
+			"limit":    fmt.Sprint(limit),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if request.Raw.StatusCode != 200 {
+			return nil, newErrorStatusNotOK(request)
+		}
+
+		pages = append(pages, result.Results...)
+
+		if result.Size == 0 || result.Links.Next == "" {
+			return pages, nil
+		}
+
+		start += result.Size
+	}
+}
+
+// SpaceExists reports whether space with given key exists and is
+// accessible by current user.
+func (api *API) SpaceExists(key string) (bool, error) {
+	request, err := api.rest.Res(
+		"space/"+key, &map[string]interface{}{},
+	).Get()
+	if err != nil {
+		return false, err
+	}
+
+	switch request.Raw.StatusCode {
+	case 200:
+		return true, nil
+
+	// Confluence responds with 404 for spaces which are not accessible as
+	// well, so they can't be distinguished
+	case 404:
+		return false, nil
+
+	default:
+		return false, newErrorStatusNotOK(request)
+	}
+}
+
 func (api *API) FindPage(space string, title string, pageType string) (*PageInfo, error) {
+	return api.FindPageWithStatus(space, title, pageType, "")
+}
+
+// FindPageWithStatus finds page with one of given comma-separated statuses
+// like "current,draft". Only current pages are found if status is empty.
+func (api *API) FindPageWithStatus(
+	space string,
+	title string,
+	pageType string,
+	status string,
+) (*PageInfo, error) {
 	result := struct {
 		Results []PageInfo `json:"results"`
 	}{}
@@ -137,6 +412,10 @@ func (api *API) FindPage(space string, title string, pageType string) (*PageInfo
 		payload["title"] = title
 	}
 
+	if status != "" {
+		payload["status"] = status
+	}
+
 	request, err := api.rest.Res(
 		"content/", &result,
 	).Get(payload)
@@ -157,15 +436,57 @@ func (api *API) FindPage(space string, title string, pageType string) (*PageInfo
 	return &result.Results[0], nil
 }
 
+// FindBlogPost finds blog post by its title and posting day in YYYY-MM-DD
+// format. If posting day is empty, blog post with given title posted at any
+// day is returned.
+func (api *API) FindBlogPost(
+	space string,
+	title string,
+	postingDay string,
+) (*PageInfo, error) {
+	result := struct {
+		Results []PageInfo `json:"results"`
+	}{}
+
+	payload := map[string]string{
+		"spaceKey": space,
+		"expand":   "ancestors,version",
+		"type":     "blogpost",
+		"title":    title,
+	}
+
+	if postingDay != "" {
+		payload["postingDay"] = postingDay
+	}
+
+	request, err := api.rest.Res(
+		"content/", &result,
+	).Get(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Raw.StatusCode != 404 && request.Raw.StatusCode != 200 {
+		return nil, newErrorStatusNotOK(request)
+	}
+
+	if len(result.Results) == 0 {
+		return nil, nil
+	}
+
+	return &result.Results[0], nil
+}
+
 func (api *API) CreateAttachment(
 	pageID string,
 	name string,
 	comment string,
 	path string,
+	contentType string,
 ) (AttachmentInfo, error) {
 	var info AttachmentInfo
 
-	form, err := getAttachmentPayload(name, comment, path)
+	form, err := getAttachmentPayload(name, comment, path, contentType)
 	if err != nil {
 		return AttachmentInfo{}, err
 	}
@@ -222,10 +543,11 @@ func (api *API) UpdateAttachment(
 	name string,
 	comment string,
 	path string,
+	contentType string,
 ) (AttachmentInfo, error) {
 	var info AttachmentInfo
 
-	form, err := getAttachmentPayload(name, comment, path)
+	form, err := getAttachmentPayload(name, comment, path, contentType)
 	if err != nil {
 		return AttachmentInfo{}, err
 	}
@@ -276,7 +598,9 @@ func (api *API) UpdateAttachment(
 	return info, nil
 }
 
-func getAttachmentPayload(name, comment, path string) (*form, error) {
+func getAttachmentPayload(
+	name, comment, path, contentType string,
+) (*form, error) {
 	var (
 		payload = bytes.NewBuffer(nil)
 		writer  = multipart.NewWriter(payload)
@@ -293,7 +617,20 @@ func getAttachmentPayload(name, comment, path string) (*form, error) {
 
 	defer file.Close()
 
-	content, err := writer.CreateFormFile("file", name)
+	// unlike CreateFormFile, content type of the file is specified, because
+	// Confluence doesn't render some files, like SVG images, uploaded as
+	// application/octet-stream
+	header := textproto.MIMEHeader{}
+	header.Set(
+		"Content-Disposition",
+		fmt.Sprintf(
+			`form-data; name="file"; filename="%s"`,
+			quoteEscaper.Replace(name),
+		),
+	)
+	header.Set("Content-Type", contentType)
+
+	content, err := writer.CreatePart(header)
 	if err != nil {
 		return nil, karma.Format(
 			err,
@@ -388,16 +725,133 @@ func (api *API) GetPageByID(pageID string) (*PageInfo, error) {
 	return request.Response.(*PageInfo), nil
 }
 
+// GetPageBody returns contents of the page in storage format.
+func (api *API) GetPageBody(pageID string) (string, error) {
+	var result struct {
+		Body struct {
+			Storage struct {
+				Value string `json:"value"`
+			} `json:"storage"`
+		} `json:"body"`
+	}
+
+	request, err := api.rest.Res(
+		"content/"+pageID, &result,
+	).Get(map[string]string{"expand": "body.storage"})
+	if err != nil {
+		return "", err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return "", newErrorStatusNotOK(request)
+	}
+
+	return result.Body.Storage.Value, nil
+}
+
+// PageContents is contents of the page in storage format with its title,
+// status and labels.
+type PageContents struct {
+	Title  string
+	Status string
+	Body   string
+	Labels []string
+}
+
+// GetPageContents returns title, status, labels and contents of the page in
+// storage format.
+func (api *API) GetPageContents(page *PageInfo) (*PageContents, error) {
+	var result struct {
+		Title  string `json:"title"`
+		Status string `json:"status"`
+		Body   struct {
+			Storage struct {
+				Value string `json:"value"`
+			} `json:"storage"`
+		} `json:"body"`
+		Metadata struct {
+			Labels struct {
+				Results []struct {
+					Name string `json:"name"`
+				} `json:"results"`
+			} `json:"labels"`
+		} `json:"metadata"`
+	}
+
+	query := map[string]string{"expand": "body.storage,metadata.labels"}
+
+	// drafts are found only if their status is specified
+	if page.Status != "" && page.Status != "current" {
+		query["status"] = page.Status
+	}
+
+	request, err := api.rest.Res(
+		"content/"+page.ID, &result,
+	).Get(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return nil, newErrorStatusNotOK(request)
+	}
+
+	contents := &PageContents{
+		Title:  result.Title,
+		Status: result.Status,
+		Body:   result.Body.Storage.Value,
+	}
+
+	for _, label := range result.Metadata.Labels.Results {
+		contents.Labels = append(contents.Labels, label.Name)
+	}
+
+	return contents, nil
+}
+
 func (api *API) CreatePage(
 	space string,
 	pageType string,
 	parent *PageInfo,
 	title string,
+	status string,
 	body string,
+	minorEdit bool,
+) (*PageInfo, error) {
+	return api.CreatePageAs(
+		space,
+		pageType,
+		parent,
+		title,
+		status,
+		body,
+		minorEdit,
+		nil,
+	)
+}
+
+// CreatePageAs creates page attributed to given author, which requires
+// impersonation permissions. If Confluence rejects the author, page is
+// created by current user instead. Page is created by current user if author
+// is nil.
+func (api *API) CreatePageAs(
+	space string,
+	pageType string,
+	parent *PageInfo,
+	title string,
+	status string,
+	body string,
+	minorEdit bool,
+	author *User,
 ) (*PageInfo, error) {
 	payload := map[string]interface{}{
 		"type":  pageType,
 		"title": title,
+		// watchers are not notified about creation if it's minor edit
+		"version": map[string]interface{}{
+			"number":    1,
+			"minorEdit": minorEdit,
+		},
 		"space": map[string]interface{}{
 			"key": space,
 		},
@@ -422,6 +876,25 @@ func (api *API) CreatePage(
 		}
 	}
 
+	if status != "" {
+		payload["status"] = status
+	}
+
+	if author != nil {
+		createdBy := map[string]interface{}{"type": "known"}
+
+		if author.AccountID != "" {
+			createdBy["accountId"] = author.AccountID
+		} else {
+			createdBy["username"] = author.Username
+			createdBy["userKey"] = author.UserKey
+		}
+
+		payload["history"] = map[string]interface{}{
+			"createdBy": createdBy,
+		}
+	}
+
 	request, err := api.rest.Res(
 		"content/", &PageInfo{},
 	).Post(payload)
@@ -429,6 +902,28 @@ func (api *API) CreatePage(
 		return nil, err
 	}
 
+	if author != nil && (request.Raw.StatusCode == http.StatusBadRequest ||
+		request.Raw.StatusCode == http.StatusForbidden) {
+		log.Warningf(
+			newErrorStatusNotOK(request),
+			"unable to create page %q on behalf of %q, "+
+				"creating it as current user",
+			title,
+			author.Username,
+		)
+
+		return api.CreatePageAs(
+			space,
+			pageType,
+			parent,
+			title,
+			status,
+			body,
+			minorEdit,
+			nil,
+		)
+	}
+
 	if request.Raw.StatusCode != 200 {
 		return nil, newErrorStatusNotOK(request)
 	}
@@ -436,8 +931,11 @@ func (api *API) CreatePage(
 	return request.Response.(*PageInfo), nil
 }
 
+// UpdatePage updates page contents and sets its status, which is either
+// "current" or "draft". Page status is not changed if status is empty.
 func (api *API) UpdatePage(
 	page *PageInfo, newContent string, minorEdit bool, newLabels []string,
+	status string,
 ) error {
 	nextPageVersion := page.Version.Number + 1
 	oldAncestors := []map[string]interface{}{}
@@ -487,9 +985,127 @@ func (api *API) UpdatePage(
 		},
 	}
 
-	request, err := api.rest.Res(
+	if status != "" {
+		payload["status"] = status
+	}
+
+	resource := api.rest.Res(
 		"content/"+page.ID, &map[string]interface{}{},
-	).Put(payload)
+	)
+
+	// drafts can be updated or published only if their status is specified
+	if page.Status != "" && page.Status != "current" {
+		resource.SetQuery(map[string]string{"status": page.Status})
+	}
+
+	request, err := resource.Put(payload)
+	if err != nil {
+		return err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return newErrorStatusNotOK(request)
+	}
+
+	return nil
+}
+
+// ArchivePage archives page, which is supported only by Confluence Cloud.
+// Pages are archived asynchronously.
+func (api *API) ArchivePage(pageID string) error {
+	request, err := api.rest.Res(
+		"content/archive", &map[string]interface{}{},
+	).Post(map[string]interface{}{
+		"pages": []map[string]interface{}{
+			{"id": pageID},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if request.Raw.StatusCode != 200 && request.Raw.StatusCode != 202 {
+		return newErrorStatusNotOK(request)
+	}
+
+	return nil
+}
+
+// GetContentProperty reads value of content property with given key into
+// value. Returns false if the page doesn't have such property.
+func (api *API) GetContentProperty(
+	pageID string,
+	key string,
+	value interface{},
+) (bool, error) {
+	property := struct {
+		Value interface{} `json:"value"`
+	}{
+		Value: value,
+	}
+
+	request, err := api.rest.Res(
+		"content/"+pageID+"/property/"+key, &property,
+	).Get()
+	if err != nil {
+		return false, err
+	}
+
+	switch request.Raw.StatusCode {
+	case 200:
+		return true, nil
+
+	case 404:
+		return false, nil
+
+	default:
+		return false, newErrorStatusNotOK(request)
+	}
+}
+
+// SetContentProperty creates or updates content property with given key.
+func (api *API) SetContentProperty(
+	pageID string,
+	key string,
+	value interface{},
+) error {
+	var property struct {
+		Version struct {
+			Number int64 `json:"number"`
+		} `json:"version"`
+	}
+
+	request, err := api.rest.Res(
+		"content/"+pageID+"/property/"+key, &property,
+	).Get()
+	if err != nil {
+		return err
+	}
+
+	switch request.Raw.StatusCode {
+	case 404:
+		request, err = api.rest.Res(
+			"content/"+pageID+"/property", &map[string]interface{}{},
+		).Post(map[string]interface{}{
+			"key":   key,
+			"value": value,
+		})
+
+	case 200:
+		request, err = api.rest.Res(
+			"content/"+pageID+"/property/"+key, &map[string]interface{}{},
+		).Put(map[string]interface{}{
+			"key":   key,
+			"value": value,
+			"version": map[string]interface{}{
+				"number": property.Version.Number + 1,
+			},
+		})
+
+	default:
+		return newErrorStatusNotOK(request)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -529,6 +1145,73 @@ func (api *API) GetUserByName(name string) (*User, error) {
 	return &response.Results[0].User, nil
 }
 
+// GetUserByUsername returns user with given username or nil if there is no
+// such user.
+func (api *API) GetUserByUsername(username string) (*User, error) {
+	var user User
+
+	request, err := api.rest.
+		Res("user", &user).
+		Get(map[string]string{
+			"username": username,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Raw.StatusCode == 404 {
+		return nil, nil
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return nil, newErrorStatusNotOK(request)
+	}
+
+	return &user, nil
+}
+
+// AddWatcher makes user watch the page and returns true, or returns false if
+// user already watches it.
+func (api *API) AddWatcher(pageID string, user *User) (bool, error) {
+	query := map[string]string{"key": user.UserKey}
+	if user.AccountID != "" {
+		query = map[string]string{"accountId": user.AccountID}
+	}
+
+	var result struct {
+		Watching bool `json:"watching"`
+	}
+
+	request, err := api.rest.
+		Res("user/watch/content/"+pageID, &result).
+		Get(query)
+	if err != nil {
+		return false, err
+	}
+
+	if request.Raw.StatusCode != 200 {
+		return false, newErrorStatusNotOK(request)
+	}
+
+	if result.Watching {
+		return false, nil
+	}
+
+	request, err = api.rest.
+		Res("user/watch/content/"+pageID, &map[string]interface{}{}).
+		SetQuery(query).
+		Post()
+	if err != nil {
+		return false, err
+	}
+
+	if request.Raw.StatusCode != 200 && request.Raw.StatusCode != 204 {
+		return false, newErrorStatusNotOK(request)
+	}
+
+	return true, nil
+}
+
 func (api *API) GetCurrentUser() (*User, error) {
 	var user User
 
@@ -0,0 +1,124 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// reAdmonition matches marker which starts blockquote rendered as admonition
+// like "> [!WARNING]".
+var reAdmonition = regexp.MustCompile(
+	`(?i)^\[!(info|tip|note|warning|panel)\][ \t]*`,
+)
+
+type admonition struct {
+	Name  string
+	Title string
+}
+
+// parseAdmonition checks that given blockquote starts with admonition marker
+// and, if so, strips the marker and remembers admonition for later rendering
+// as macro. Bold line or heading following the marker is used as title of
+// the macro and removed from its body.
+func (renderer ConfluenceRenderer) parseAdmonition(quote *bf.Node) bool {
+	paragraph := quote.FirstChild
+	if paragraph == nil || paragraph.Type != bf.Paragraph {
+		return false
+	}
+
+	text := paragraph.FirstChild
+	if text == nil || text.Type != bf.Text {
+		return false
+	}
+
+	match := reAdmonition.FindSubmatchIndex(text.Literal)
+	if match == nil {
+		return false
+	}
+
+	// marker should be followed by line break or bold title
+	rest := text.Literal[match[1]:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("\n")):
+		rest = rest[1:]
+
+	case len(rest) > 0:
+		return false
+
+	case text.Next != nil && text.Next.Type != bf.Strong:
+		return false
+	}
+
+	admonition := admonition{
+		Name: strings.ToLower(string(text.Literal[match[2]:match[3]])),
+	}
+
+	text.Literal = rest
+	if len(text.Literal) == 0 {
+		text.Unlink()
+	}
+
+	if title := paragraph.FirstChild; title != nil && title.Type == bf.Strong {
+		next := title.Next
+		if next == nil ||
+			(next.Type == bf.Text && bytes.HasPrefix(next.Literal, []byte("\n"))) {
+			admonition.Title = nodeText(title)
+
+			title.Unlink()
+
+			if next != nil {
+				next.Literal = next.Literal[1:]
+				if len(next.Literal) == 0 {
+					next.Unlink()
+				}
+			}
+		}
+	}
+
+	if paragraph.FirstChild == nil {
+		paragraph.Unlink()
+
+		heading := quote.FirstChild
+		if admonition.Title == "" && heading != nil && heading.Type == bf.Heading {
+			admonition.Title = nodeText(heading)
+
+			heading.Unlink()
+		}
+	}
+
+	renderer.admonitions[quote] = admonition
+
+	return true
+}
+
+// renderAdmonition renders blockquote as info, tip, note, warning or panel
+// macro.
+func (renderer ConfluenceRenderer) renderAdmonition(
+	writer io.Writer,
+	admonition admonition,
+	entering bool,
+) {
+	if !entering {
+		fmt.Fprint(writer, "</ac:rich-text-body>\n</ac:structured-macro>\n")
+
+		return
+	}
+
+	fmt.Fprintf(writer, `<ac:structured-macro ac:name="%s">`+"\n", admonition.Name)
+
+	if admonition.Title != "" {
+		fmt.Fprintf(
+			writer,
+			`<ac:parameter ac:name="title">%s</ac:parameter>`+"\n",
+			html.EscapeString(admonition.Title),
+		)
+	}
+
+	fmt.Fprint(writer, "<ac:rich-text-body>\n")
+}
@@ -66,7 +66,7 @@ func EnsureAncestry(
 
 	if !dryRun {
 		for _, title := range rest {
-			page, err := api.CreatePage(space, "page", parent, title, ``)
+			page, err := api.CreatePage(space, "page", parent, title, ``, ``, false)
 			if err != nil {
 				return nil, karma.Format(
 					err,
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"html"
 	"io"
+	"mime"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kovetskiy/mark/pkg/confluence"
 	"github.com/reconquest/karma-go"
@@ -21,29 +27,206 @@ const (
 	AttachmentChecksumPrefix = `mark:checksum: `
 )
 
+// MediaExtensions lists extensions of attachments which are embedded into
+// page using multimedia macro instead of image.
+var MediaExtensions = []string{".mp4", ".webm", ".ogg", ".mov"}
+
+// DocumentMacros maps extensions of documents which are embedded into page
+// using viewer macros instead of image to names of these macros.
+var DocumentMacros = map[string]string{
+	".pdf":  "viewpdf",
+	".doc":  "viewdoc",
+	".docx": "viewdoc",
+	".xls":  "viewxls",
+	".xlsx": "viewxls",
+	".ppt":  "viewppt",
+	".pptx": "viewppt",
+}
+
+// ContentTypes maps extensions of attachments to content types, which
+// override ones known to the system, since Confluence renders SVG images only
+// if they are uploaded as image/svg+xml.
+var ContentTypes = map[string]string{
+	".svg": "image/svg+xml",
+}
+
+// AttachmentRetryDelay is a delay before first retry of failed attachment
+// upload, which is doubled before every next retry.
+var AttachmentRetryDelay = time.Second
+
+var reImageLink = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+
 type Attachment struct {
-	ID       string
-	Name     string
-	Filename string
-	Path     string
-	Checksum string
-	Link     string
-	Replace  string
+	ID          string
+	Name        string
+	Filename    string
+	Path        string
+	ContentType string
+	Checksum    string
+	Link        string
+	Replace     string
+
+	// Skipped is set if attachment is not uploaded because of error, so it
+	// should be uploaded on next run. Images referencing skipped attachment,
+	// which has no previous version, are replaced with placeholder.
+	Skipped bool
+}
+
+// AttachmentPolicy specifies how failed uploads of attachments are handled,
+// so single flaky upload doesn't fail update of the whole page.
+type AttachmentPolicy struct {
+	// Retries is number of times failed upload is retried.
+	Retries int
+
+	// Skip attachments which are failed to upload after all retries with
+	// warning instead of returning error. Previous version of updated
+	// attachment is kept, images referencing new attachment are replaced
+	// with placeholder.
+	Skip bool
+}
+
+// FindAttachment returns path of attachment with given name, which is looked
+// up in given directories in order.
+func FindAttachment(dirs []string, name string) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+
+		if _, err := os.Stat(path); err == nil {
+			log.Debugf(nil, "attachment %q is found in %s", name, dir)
+
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf(
+		"attachment %q is not found in: %s",
+		name,
+		strings.Join(dirs, ", "),
+	)
+}
+
+// SkipMissingAttachments removes optional attachments, which are not found
+// in any of given directories, reporting them with warning. Optional glob
+// patterns are left as is, since patterns without matches are reported by
+// ExpandAttachments anyway.
+func SkipMissingAttachments(
+	dirs []string,
+	attachments map[string]string,
+	optional map[string]bool,
+) map[string]string {
+	result := map[string]string{}
+
+	for replace, name := range attachments {
+		if optional[name] && !strings.ContainsAny(name, "*?[") {
+			if _, err := FindAttachment(dirs, name); err != nil {
+				log.Warningf(err, "optional attachment %q is skipped", name)
+
+				continue
+			}
+		}
+
+		result[replace] = name
+	}
+
+	return result
 }
 
+// ExpandAttachments replaces attachments specified as glob patterns like
+// images/*.png with every file matching the pattern relative to any of given
+// directories. Files which are already listed explicitly or are found in
+// previous directories are not duplicated.
+func ExpandAttachments(
+	dirs []string,
+	attachments map[string]string,
+) (map[string]string, error) {
+	expanded := map[string]string{}
+	names := map[string]bool{}
+	patterns := []string{}
+
+	for replace, name := range attachments {
+		if !strings.ContainsAny(name, "*?[") {
+			expanded[replace] = name
+			names[name] = true
+
+			continue
+		}
+
+		patterns = append(patterns, name)
+	}
+
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		found := false
+
+		for _, dir := range dirs {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, karma.Format(
+					err,
+					"invalid attachment pattern: %q", pattern,
+				)
+			}
+
+			for _, match := range matches {
+				name, err := filepath.Rel(dir, match)
+				if err != nil {
+					return nil, err
+				}
+
+				name = filepath.ToSlash(name)
+
+				found = true
+
+				if names[name] {
+					continue
+				}
+
+				expanded[name] = name
+				names[name] = true
+			}
+		}
+
+		if !found {
+			log.Warningf(
+				nil,
+				"attachment pattern %q doesn't match any file",
+				pattern,
+			)
+		}
+	}
+
+	return expanded, nil
+}
+
+// ResolveAttachments uploads attachments, which are looked up in given
+// directories in order, to the page unless they are uploaded already. Failed
+// uploads are handled according to given policy.
 func ResolveAttachments(
 	api *confluence.API,
 	page *confluence.PageInfo,
-	base string,
+	dirs []string,
 	replacements map[string]string,
+	policy AttachmentPolicy,
 ) ([]Attachment, error) {
+	replacements, err := ExpandAttachments(dirs, replacements)
+	if err != nil {
+		return nil, err
+	}
+
 	attaches := []Attachment{}
 	for replace, name := range replacements {
+		path, err := FindAttachment(dirs, name)
+		if err != nil {
+			return nil, err
+		}
+
 		attach := Attachment{
-			Name:     name,
-			Filename: strings.ReplaceAll(name, "/", "_"),
-			Path:     filepath.Join(base, name),
-			Replace:  replace,
+			Name:        name,
+			Filename:    strings.ReplaceAll(name, "/", "_"),
+			Path:        path,
+			ContentType: contentType(name),
+			Replace:     replace,
 		}
 
 		checksum, err := getChecksum(attach.Path)
@@ -103,18 +286,35 @@ func ResolveAttachments(
 	for i, attach := range creating {
 		log.Infof(nil, "creating attachment: %q", attach.Name)
 
-		info, err := api.CreateAttachment(
-			page.ID,
-			attach.Filename,
-			AttachmentChecksumPrefix+attach.Checksum,
-			attach.Path,
+		info, err := uploadAttachment(
+			policy,
+			func() (confluence.AttachmentInfo, error) {
+				return api.CreateAttachment(
+					page.ID,
+					attach.Filename,
+					AttachmentChecksumPrefix+attach.Checksum,
+					attach.Path,
+					attach.ContentType,
+				)
+			},
 		)
 		if err != nil {
-			return nil, karma.Format(
+			err = karma.Format(
 				err,
 				"unable to create attachment %q",
 				attach.Name,
 			)
+
+			if !policy.Skip {
+				return nil, err
+			}
+
+			log.Warningf(err, "attachment %q is skipped", attach.Name)
+
+			attach.Skipped = true
+			creating[i] = attach
+
+			continue
 		}
 
 		attach.ID = info.ID
@@ -129,19 +329,42 @@ func ResolveAttachments(
 	for i, attach := range updating {
 		log.Infof(nil, "updating attachment: %q", attach.Name)
 
-		info, err := api.UpdateAttachment(
-			page.ID,
-			attach.ID,
-			attach.Name,
-			AttachmentChecksumPrefix+attach.Checksum,
-			attach.Path,
+		info, err := uploadAttachment(
+			policy,
+			func() (confluence.AttachmentInfo, error) {
+				return api.UpdateAttachment(
+					page.ID,
+					attach.ID,
+					attach.Name,
+					AttachmentChecksumPrefix+attach.Checksum,
+					attach.Path,
+					attach.ContentType,
+				)
+			},
 		)
 		if err != nil {
-			return nil, karma.Format(
+			err = karma.Format(
 				err,
 				"unable to update attachment %q",
 				attach.Name,
 			)
+
+			if !policy.Skip {
+				return nil, err
+			}
+
+			// link to previous version is already known, so page
+			// references it until next run
+			log.Warningf(
+				err,
+				"attachment %q is skipped, previous version is kept",
+				attach.Name,
+			)
+
+			attach.Skipped = true
+			updating[i] = attach
+
+			continue
 		}
 
 		attach.Link = path.Join(
@@ -160,11 +383,63 @@ func ResolveAttachments(
 	return attaches, nil
 }
 
+// uploadAttachment calls given upload function until it succeeds or retries
+// specified by policy are exhausted.
+func uploadAttachment(
+	policy AttachmentPolicy,
+	upload func() (confluence.AttachmentInfo, error),
+) (confluence.AttachmentInfo, error) {
+	delay := AttachmentRetryDelay
+
+	for retry := 1; ; retry++ {
+		info, err := upload()
+		if err == nil || retry > policy.Retries {
+			return info, err
+		}
+
+		log.Warningf(
+			err,
+			"attachment upload failed, retrying in %s (%d/%d)",
+			delay,
+			retry,
+			policy.Retries,
+		)
+
+		time.Sleep(delay)
+
+		delay *= 2
+	}
+}
+
+// CompileAttachmentLinks replaces references to attachments in markdown
+// with their links. Images referencing skipped attachments are replaced with
+// placeholder, so page shows that image is missing.
 func CompileAttachmentLinks(markdown []byte, attaches []Attachment) []byte {
 	links := map[string]string{}
 	replaces := []string{}
 
 	for _, attach := range attaches {
+		if attach.Skipped && attach.Link == "" {
+			image := regexp.MustCompile(
+				`!\[[^\]]*\]\(` + regexp.QuoteMeta(attach.Replace) + `\)`,
+			)
+
+			markdown = image.ReplaceAllLiteral(
+				markdown,
+				[]byte(fmt.Sprintf(
+					`<ac:structured-macro ac:name="status">`+
+						`<ac:parameter ac:name="colour">Red</ac:parameter>`+
+						`<ac:parameter ac:name="title">`+
+						`missing attachment: %s`+
+						`</ac:parameter>`+
+						`</ac:structured-macro>`,
+					html.EscapeString(attach.Filename),
+				)),
+			)
+
+			continue
+		}
+
 		uri, err := url.ParseRequestURI(attach.Link)
 		if err != nil {
 			links[attach.Replace] = strings.ReplaceAll("&", "&amp;", attach.Link)
@@ -222,9 +497,237 @@ func CompileAttachmentLinks(markdown []byte, attaches []Attachment) []byte {
 		}
 	}
 
+	for _, attach := range attaches {
+		if attach.Skipped && attach.Link == "" {
+			continue
+		}
+
+		macro := "multimedia"
+		if !isMedia(attach.Name) {
+			macro = documentMacro(attach.Name)
+			if macro == "" {
+				continue
+			}
+		}
+
+		image := regexp.MustCompile(
+			`!\[[^\]]*\]\(` + regexp.QuoteMeta(links[attach.Replace]) + `\)`,
+		)
+
+		markdown = image.ReplaceAllLiteral(
+			markdown,
+			[]byte(fmt.Sprintf(
+				`<ac:structured-macro ac:name="%s">`+
+					`<ac:parameter ac:name="name">`+
+					`<ri:attachment ri:filename="%s" />`+
+					`</ac:parameter>`+
+					`</ac:structured-macro>`,
+				macro,
+				attach.Filename,
+			)),
+		)
+	}
+
 	return markdown
 }
 
+// ExtractMediaAttachments returns paths of local media files and documents
+// which are embedded into markdown as images, e.g. ![demo](demo.mp4) or
+// ![report](report.pdf), so they can be uploaded without explicit Attachment
+// header. Files are looked up in given directories in order.
+func ExtractMediaAttachments(markdown []byte, dirs []string) []string {
+	paths := []string{}
+
+	for _, match := range reImageLink.FindAllSubmatch(markdown, -1) {
+		path := string(match[1])
+
+		if strings.Contains(path, "://") ||
+			(!isMedia(path) && documentMacro(path) == "") {
+			continue
+		}
+
+		if _, err := FindAttachment(dirs, path); err != nil {
+			log.Warningf(err, "media file %q is not found", path)
+
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+func documentMacro(name string) string {
+	return DocumentMacros[strings.ToLower(filepath.Ext(name))]
+}
+
+// LinkDocuments converts documents embedded as images like
+// ![report](report.pdf) into links, so they are rendered as download links
+// instead of viewer macros, which are not available on some instances.
+func LinkDocuments(markdown []byte) []byte {
+	return reImageLink.ReplaceAllFunc(markdown, func(match []byte) []byte {
+		path := reImageLink.FindSubmatch(match)[1]
+		if documentMacro(string(path)) == "" {
+			return match
+		}
+
+		return match[1:]
+	})
+}
+
+var rePageAttachmentLink = regexp.MustCompile(
+	`(!?)\[([^\]]*)\]\(attachment://([^)]+)/([^/)]+)\)`,
+)
+
+var attachmentPages = struct {
+	sync.Mutex
+	ids map[string]string
+}{ids: map[string]string{}}
+
+// ResolvePageAttachments replaces images and links referencing attachments
+// of other pages in the space like ![logo](attachment://Assets/logo.png) or
+// [guide](attachment://Assets/guide.pdf) with references to these
+// attachments, so shared files are not uploaded to every page. It should be
+// called after attachments of the page itself are compiled, because legacy
+// links to them use the same scheme. Pages are retrieved only once per run.
+func ResolvePageAttachments(
+	api *confluence.API,
+	space string,
+	markdown []byte,
+) []byte {
+	return substitutePageAttachments(markdown, func(title string) string {
+		attachmentPages.Lock()
+		defer attachmentPages.Unlock()
+
+		key := space + "/" + title
+		if id, ok := attachmentPages.ids[key]; ok {
+			return id
+		}
+
+		page, err := api.FindPage(space, title, TypePage)
+		if err != nil {
+			log.Warningf(err, "unable to find page %q", title)
+		}
+
+		var id string
+		if page != nil {
+			id = page.ID
+		}
+
+		attachmentPages.ids[key] = id
+
+		return id
+	})
+}
+
+func substitutePageAttachments(
+	markdown []byte,
+	lookup func(string) string,
+) []byte {
+	code := codeRanges(markdown)
+
+	var buffer bytes.Buffer
+
+	last := 0
+	for _, match := range rePageAttachmentLink.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		var (
+			image    = match[3] > match[2]
+			text     = string(markdown[match[4]:match[5]])
+			title    = string(markdown[match[6]:match[7]])
+			filename = string(markdown[match[8]:match[9]])
+		)
+
+		if unescaped, err := url.PathUnescape(title); err == nil {
+			title = unescaped
+		}
+
+		if unescaped, err := url.PathUnescape(filename); err == nil {
+			filename = unescaped
+		}
+
+		id := lookup(title)
+		if id == "" {
+			log.Warningf(
+				nil,
+				"attachment %q is not resolved: page %q is not found",
+				filename,
+				title,
+			)
+
+			continue
+		}
+
+		attachment := fmt.Sprintf(
+			`<ri:attachment ri:filename="%s">`+
+				`<ri:content-entity ri:content-id="%s" />`+
+				`</ri:attachment>`,
+			escapeAttribute(filename),
+			escapeAttribute(id),
+		)
+
+		buffer.Write(markdown[last:match[0]])
+
+		if image {
+			fmt.Fprintf(
+				&buffer,
+				`<ac:image ac:alt="%s" ac:title="%s">%s</ac:image>`,
+				escapeAttribute(text),
+				escapeAttribute(text),
+				attachment,
+			)
+		} else {
+			if text == "" {
+				text = filename
+			}
+
+			fmt.Fprintf(
+				&buffer,
+				`<ac:link>%s<ac:link-body>%s</ac:link-body></ac:link>`,
+				attachment,
+				escapeAttribute(text),
+			)
+		}
+
+		last = match[1]
+	}
+
+	buffer.Write(markdown[last:])
+
+	return buffer.Bytes()
+}
+
+func isMedia(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, media := range MediaExtensions {
+		if ext == media {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentType returns content type of attachment with given name, falling
+// back to application/octet-stream for unknown extensions.
+func contentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	if contentType, ok := ContentTypes[ext]; ok {
+		return contentType
+	}
+
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
+
 func getChecksum(filename string) (string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
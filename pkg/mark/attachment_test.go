@@ -0,0 +1,324 @@
+package mark
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/pkg/confluence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileAttachmentLinks_Media(t *testing.T) {
+	test := assert.New(t)
+
+	attaches := []Attachment{
+		{
+			Name:     "videos/demo.mp4",
+			Filename: "videos_demo.mp4",
+			Replace:  "videos/demo.mp4",
+			Link:     "/download/attachments/1/videos_demo.mp4?version=1",
+		},
+	}
+
+	markdown := CompileAttachmentLinks(
+		[]byte(text(
+			"![demo](videos/demo.mp4)",
+			"[download](videos/demo.mp4)",
+		)),
+		attaches,
+	)
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="multimedia">`+
+				`<ac:parameter ac:name="name">`+
+				`<ri:attachment ri:filename="videos_demo.mp4" />`+
+				`</ac:parameter>`+
+				`</ac:structured-macro>`,
+			"[download](/download/attachments/1/videos_demo.mp4?version%3D1)",
+		),
+		string(markdown),
+	)
+}
+
+func TestCompileAttachmentLinks_Documents(t *testing.T) {
+	test := assert.New(t)
+
+	attaches := []Attachment{
+		{
+			Name:     "report.PDF",
+			Filename: "report.PDF",
+			Replace:  "report.PDF",
+			Link:     "/download/attachments/1/report.PDF?version=1",
+		},
+	}
+
+	markdown := []byte("![report](report.PDF)")
+
+	test.Equal(
+		`<ac:structured-macro ac:name="viewpdf">`+
+			`<ac:parameter ac:name="name">`+
+			`<ri:attachment ri:filename="report.PDF" />`+
+			`</ac:parameter>`+
+			`</ac:structured-macro>`,
+		string(CompileAttachmentLinks(markdown, attaches)),
+	)
+
+	test.Equal(
+		"[report](/download/attachments/1/report.PDF?version%3D1)",
+		string(CompileAttachmentLinks(LinkDocuments(markdown), attaches)),
+	)
+}
+
+func TestCompileAttachmentLinks_Skipped(t *testing.T) {
+	test := assert.New(t)
+
+	attaches := []Attachment{
+		{
+			Name:     "images/a.png",
+			Filename: "images_a.png",
+			Replace:  "images/a.png",
+			Link:     "/download/attachments/1/images_a.png?version=1",
+		},
+		{
+			Name:     "images/b.png",
+			Filename: "images_b.png",
+			Replace:  "images/b.png",
+			Skipped:  true,
+		},
+		{
+			Name:     "images/c.png",
+			Filename: "images_c.png",
+			Replace:  "images/c.png",
+			Link:     "/download/attachments/1/images_c.png?version=1",
+			Skipped:  true,
+		},
+	}
+
+	markdown := CompileAttachmentLinks(
+		[]byte(text(
+			"![a](images/a.png)",
+			"![c](images/c.png)",
+			"![b](images/b.png)",
+		)),
+		attaches,
+	)
+
+	test.Equal(
+		text(
+			"![a](/download/attachments/1/images_a.png?version%3D1)",
+			"![c](/download/attachments/1/images_c.png?version%3D1)",
+			`<ac:structured-macro ac:name="status">`+
+				`<ac:parameter ac:name="colour">Red</ac:parameter>`+
+				`<ac:parameter ac:name="title">`+
+				`missing attachment: images_b.png`+
+				`</ac:parameter>`+
+				`</ac:structured-macro>`,
+		),
+		string(markdown),
+	)
+}
+
+func TestUploadAttachment(t *testing.T) {
+	test := assert.New(t)
+
+	delay := AttachmentRetryDelay
+	defer func() {
+		AttachmentRetryDelay = delay
+	}()
+
+	AttachmentRetryDelay = 0
+
+	flaky := func(failures int, calls *int) func() (
+		confluence.AttachmentInfo,
+		error,
+	) {
+		return func() (confluence.AttachmentInfo, error) {
+			*calls++
+			if *calls <= failures {
+				return confluence.AttachmentInfo{}, errors.New("timeout")
+			}
+
+			return confluence.AttachmentInfo{ID: "1"}, nil
+		}
+	}
+
+	calls := 0
+	info, err := uploadAttachment(AttachmentPolicy{Retries: 2}, flaky(2, &calls))
+	test.NoError(err)
+	test.Equal("1", info.ID)
+	test.Equal(3, calls)
+
+	calls = 0
+	_, err = uploadAttachment(AttachmentPolicy{Retries: 1}, flaky(2, &calls))
+	test.Error(err)
+	test.Equal(2, calls)
+
+	calls = 0
+	_, err = uploadAttachment(AttachmentPolicy{}, flaky(1, &calls))
+	test.Error(err)
+	test.Equal(1, calls)
+}
+
+func TestExpandAttachments(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	test.NoError(os.Mkdir(filepath.Join(dir, "images"), 0755))
+
+	for _, name := range []string{"a.png", "b.png", "c.jpg"} {
+		err := ioutil.WriteFile(filepath.Join(dir, "images", name), nil, 0644)
+		test.NoError(err)
+	}
+
+	attachments, err := ExpandAttachments([]string{dir}, map[string]string{
+		"images/*.png": "images/*.png",
+		"images/a.png": "images/a.png",
+		"images/c.jpg": "images/c.jpg",
+	})
+	test.NoError(err)
+	test.Equal(map[string]string{
+		"images/a.png": "images/a.png",
+		"images/b.png": "images/b.png",
+		"images/c.jpg": "images/c.jpg",
+	}, attachments)
+}
+
+func TestSubstitutePageAttachments(t *testing.T) {
+	test := assert.New(t)
+
+	lookup := func(title string) string {
+		if title != "Shared Assets" {
+			return ""
+		}
+
+		return "42"
+	}
+
+	markdown := substitutePageAttachments(
+		[]byte(text(
+			"![logo](attachment://Shared%20Assets/logo.png)",
+			"[](attachment://Shared%20Assets/guide.pdf)",
+			"![missing](attachment://Unknown/logo.png)",
+			"`![logo](attachment://Shared%20Assets/logo.png)`",
+		)),
+		lookup,
+	)
+
+	test.Equal(
+		text(
+			`<ac:image ac:alt="logo" ac:title="logo">`+
+				`<ri:attachment ri:filename="logo.png">`+
+				`<ri:content-entity ri:content-id="42" />`+
+				`</ri:attachment></ac:image>`,
+			`<ac:link><ri:attachment ri:filename="guide.pdf">`+
+				`<ri:content-entity ri:content-id="42" />`+
+				`</ri:attachment>`+
+				`<ac:link-body>guide.pdf</ac:link-body></ac:link>`,
+			"![missing](attachment://Unknown/logo.png)",
+			"`![logo](attachment://Shared%20Assets/logo.png)`",
+		),
+		string(markdown),
+	)
+
+	test.Equal(
+		`<p><ac:image ac:alt="logo" ac:title="logo">`+
+			`<ri:attachment ri:filename="logo.png">`+
+			`<ri:content-entity ri:content-id="42" />`+
+			`</ri:attachment></ac:image></p>`+"\n",
+		CompileMarkdown(
+			substitutePageAttachments(
+				[]byte("![logo](attachment://Shared%20Assets/logo.png)"),
+				lookup,
+			),
+			nil,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestFindAttachment(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"docs/a.png", "assets/a.png", "assets/b.png"} {
+		path = filepath.Join(dir, path)
+
+		test.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		test.NoError(ioutil.WriteFile(path, nil, 0644))
+	}
+
+	dirs := []string{filepath.Join(dir, "docs"), filepath.Join(dir, "assets")}
+
+	path, err := FindAttachment(dirs, "a.png")
+	test.NoError(err)
+	test.Equal(filepath.Join(dir, "docs", "a.png"), path)
+
+	path, err = FindAttachment(dirs, "b.png")
+	test.NoError(err)
+	test.Equal(filepath.Join(dir, "assets", "b.png"), path)
+
+	_, err = FindAttachment(dirs, "c.png")
+	test.Error(err)
+
+	attachments, err := ExpandAttachments(dirs, map[string]string{
+		"*.png": "*.png",
+	})
+	test.NoError(err)
+	test.Equal(map[string]string{
+		"a.png": "a.png",
+		"b.png": "b.png",
+	}, attachments)
+}
+
+func TestSkipMissingAttachments(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	test.NoError(ioutil.WriteFile(filepath.Join(dir, "a.png"), nil, 0644))
+
+	test.Equal(
+		map[string]string{
+			"a.png": "a.png",
+			"b.png": "b.png",
+			"*.jpg": "*.jpg",
+		},
+		SkipMissingAttachments(
+			[]string{dir},
+			map[string]string{
+				"a.png": "a.png",
+				"b.png": "b.png",
+				"c.png": "c.png",
+				"*.jpg": "*.jpg",
+			},
+			map[string]bool{
+				"a.png": true,
+				"c.png": true,
+				"*.jpg": true,
+			},
+		),
+	)
+}
+
+func TestContentType(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("image/svg+xml", contentType("diagrams/flow.SVG"))
+	test.Equal("image/png", contentType("logo.png"))
+	test.Equal("application/octet-stream", contentType("data.unknown-ext"))
+}
@@ -0,0 +1,34 @@
+package mark
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+)
+
+// DefaultManagedBanner is a text of banner added with --managed-banner.
+const DefaultManagedBanner = "This page is generated by mark from markdown " +
+	"source, manual changes will be overwritten on next update."
+
+const managedBannerID = "mark-managed-banner"
+
+var reManagedBanner = regexp.MustCompile(
+	`(?s)<ac:structured-macro ac:name="note" ac:macro-id="` +
+		managedBannerID + `">.*?</ac:structured-macro>\n?`,
+)
+
+// AddManagedBanner adds note panel with given text on top of the page,
+// which explains that page shouldn't be edited manually. Banner which is
+// already added is replaced, so banner is never added twice.
+func AddManagedBanner(contents string, text string) string {
+	contents = reManagedBanner.ReplaceAllString(contents, "")
+
+	return fmt.Sprintf(
+		`<ac:structured-macro ac:name="note" ac:macro-id="%s">`+
+			`<ac:rich-text-body><p>%s</p></ac:rich-text-body>`+
+			"</ac:structured-macro>\n%s",
+		managedBannerID,
+		html.EscapeString(text),
+		contents,
+	)
+}
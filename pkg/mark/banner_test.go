@@ -0,0 +1,21 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddManagedBanner(t *testing.T) {
+	test := assert.New(t)
+
+	banner := `<ac:structured-macro ac:name="note" ` +
+		`ac:macro-id="mark-managed-banner">` +
+		`<ac:rich-text-body><p>Don&#39;t edit</p></ac:rich-text-body>` +
+		"</ac:structured-macro>\n"
+
+	html := AddManagedBanner("<p>contents</p>\n", "Don't edit")
+
+	test.Equal(banner+"<p>contents</p>\n", html)
+	test.Equal(banner+"<p>contents</p>\n", AddManagedBanner(html, "Don't edit"))
+}
@@ -0,0 +1,112 @@
+package mark
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+// BundleDir returns temporary directory, which bundle with given path is
+// extracted into. Directory is the same for every run, so directory left by
+// run, which has exited on error without removing it, is reused by the next
+// run instead of being left forever.
+func BundleDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(path))
+
+	return filepath.Join(
+		os.TempDir(),
+		"mark-bundle-"+hex.EncodeToString(hash[:8]),
+	), nil
+}
+
+// ExtractBundle extracts zip archive with markdown files and their assets
+// into temporary directory returned by BundleDir and returns path to it.
+// Contents left in the directory by previous runs are removed. Caller is
+// responsible for removing the directory.
+func ExtractBundle(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", karma.Format(err, "unable to open bundle %q", path)
+	}
+
+	defer archive.Close()
+
+	dir, err := BundleDir(path)
+	if err != nil {
+		return "", karma.Format(err, "unable to get bundle directory")
+	}
+
+	err = os.RemoveAll(dir)
+	if err == nil {
+		err = os.MkdirAll(dir, 0700)
+	}
+
+	if err != nil {
+		return "", karma.Format(err, "unable to create bundle directory")
+	}
+
+	for _, file := range archive.File {
+		err := extractBundleFile(dir, file)
+		if err != nil {
+			os.RemoveAll(dir)
+
+			return "", karma.Format(
+				err,
+				"unable to extract %q from bundle %q",
+				file.Name,
+				path,
+			)
+		}
+	}
+
+	return dir, nil
+}
+
+func extractBundleFile(dir string, file *zip.File) error {
+	target := filepath.Join(dir, filepath.FromSlash(file.Name))
+
+	// entries like ../../etc/passwd should never be written outside of
+	// bundle directory
+	if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+		return fmt.Errorf("entry path is outside of bundle")
+	}
+
+	if file.FileInfo().IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	writer, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	defer writer.Close()
+
+	_, err = io.Copy(writer, reader)
+
+	return err
+}
@@ -0,0 +1,102 @@
+package mark
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBundle(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	for name, contents := range files {
+		writer, err := archive.Create(name)
+		assert.NoError(t, err)
+
+		_, err = writer.Write([]byte(contents))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, archive.Close())
+}
+
+func TestExtractBundle(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "doc.zip")
+
+	writeBundle(t, path, map[string]string{
+		"docs/index.md":       "# Doc\n",
+		"docs/images/a.png":   "png",
+		"templates/footer.md": "footer",
+	})
+
+	bundle, err := ExtractBundle(path)
+	test.NoError(err)
+
+	defer os.RemoveAll(bundle)
+
+	contents, err := ioutil.ReadFile(filepath.Join(bundle, "docs", "index.md"))
+	test.NoError(err)
+	test.Equal("# Doc\n", string(contents))
+
+	contents, err = ioutil.ReadFile(filepath.Join(bundle, "docs", "images", "a.png"))
+	test.NoError(err)
+	test.Equal("png", string(contents))
+
+	writeBundle(t, path, map[string]string{
+		"../escape.md": "text",
+	})
+
+	_, err = ExtractBundle(path)
+	test.Error(err)
+
+	_, err = ExtractBundle(filepath.Join(dir, "missing.zip"))
+	test.Error(err)
+}
+
+func TestExtractBundle_SameDir(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "doc.zip")
+
+	writeBundle(t, path, map[string]string{"index.md": "# Doc\n"})
+
+	bundle, err := ExtractBundle(path)
+	test.NoError(err)
+
+	defer os.RemoveAll(bundle)
+
+	// left by run which exited on error
+	err = ioutil.WriteFile(filepath.Join(bundle, "stale.md"), nil, 0644)
+	test.NoError(err)
+
+	again, err := ExtractBundle(path)
+	test.NoError(err)
+	test.Equal(bundle, again)
+
+	_, err = os.Stat(filepath.Join(bundle, "stale.md"))
+	test.True(os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(bundle, "index.md"))
+	test.NoError(err)
+}
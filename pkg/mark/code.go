@@ -0,0 +1,40 @@
+package mark
+
+import (
+	"regexp"
+	"sort"
+)
+
+var (
+	reFencedCode = regexp.MustCompile("(?ms)^[ \\t]*(```|~~~).*?^[ \\t]*(```|~~~)[ \\t]*$")
+	reInlineCode = regexp.MustCompile("`[^`\\n]+`")
+)
+
+// codeRanges returns sorted [start, end) offsets of fenced code blocks and
+// code spans in given markdown, so transformations of plain text can leave
+// code intact.
+func codeRanges(markdown []byte) [][]int {
+	ranges := reFencedCode.FindAllIndex(markdown, -1)
+
+	for _, span := range reInlineCode.FindAllIndex(markdown, -1) {
+		if !insideRanges(ranges, span[0]) {
+			ranges = append(ranges, span)
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+
+	return ranges
+}
+
+func insideRanges(ranges [][]int, offset int) bool {
+	for _, item := range ranges {
+		if offset >= item[0] && offset < item[1] {
+			return true
+		}
+	}
+
+	return false
+}
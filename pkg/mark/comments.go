@@ -0,0 +1,15 @@
+package mark
+
+import (
+	"regexp"
+)
+
+var reComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// StripComments removes HTML comments from compiled page, comments inside
+// CDATA sections like code blocks are kept.
+func StripComments(contents string) string {
+	return replaceOutsideCDATA(contents, func(contents string) string {
+		return reComment.ReplaceAllString(contents, "")
+	})
+}
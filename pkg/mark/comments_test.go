@@ -0,0 +1,23 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripComments(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		"<p>text </p>\n\n",
+		StripComments("<p>text <!-- TODO --></p>\n<!--\nmulti\nline\n-->\n"),
+	)
+
+	test.Equal(
+		"<ac:plain-text-body><![CDATA[<!-- code -->]]></ac:plain-text-body>",
+		StripComments(
+			"<ac:plain-text-body><![CDATA[<!-- code -->]]></ac:plain-text-body>",
+		),
+	)
+}
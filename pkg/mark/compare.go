@@ -0,0 +1,88 @@
+package mark
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Normalizations which can be applied to page contents before comparing
+// them with contents of the page in Confluence, which formats them in its
+// own way.
+const (
+	// NormalizeBetweenTags removes whitespace between tags.
+	NormalizeBetweenTags = `between-tags`
+
+	// NormalizeSpaces collapses every run of whitespace into single space.
+	NormalizeSpaces = `spaces`
+
+	// NormalizeEdges removes whitespace at the start and at the end.
+	NormalizeEdges = `edges`
+)
+
+// DefaultNormalizations are used if normalizations are not configured.
+var DefaultNormalizations = []string{NormalizeBetweenTags, NormalizeEdges}
+
+var (
+	reBetweenTags = regexp.MustCompile(`>\s+<`)
+	reSpaces      = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeHTML applies given normalizations to contents, so insignificant
+// differences are not taken into account while comparing them. Contents of
+// CDATA sections, like code blocks, are never changed.
+func NormalizeHTML(contents string, normalizations []string) (string, error) {
+	for _, normalization := range normalizations {
+		switch normalization {
+		case NormalizeBetweenTags:
+			contents = replaceOutsideCDATA(
+				contents,
+				func(part string) string {
+					return reBetweenTags.ReplaceAllString(part, "><")
+				},
+			)
+
+		case NormalizeSpaces:
+			contents = replaceOutsideCDATA(
+				contents,
+				func(part string) string {
+					return reSpaces.ReplaceAllString(part, " ")
+				},
+			)
+
+		case NormalizeEdges:
+			contents = strings.TrimSpace(contents)
+
+		default:
+			return "", fmt.Errorf(
+				"unknown normalization %q, expected one of: %s",
+				normalization,
+				strings.Join(
+					[]string{
+						NormalizeBetweenTags,
+						NormalizeSpaces,
+						NormalizeEdges,
+					},
+					", ",
+				),
+			)
+		}
+	}
+
+	return contents, nil
+}
+
+// SameHTML reports whether contents are the same after normalization.
+func SameHTML(a, b string, normalizations []string) (bool, error) {
+	a, err := NormalizeHTML(a, normalizations)
+	if err != nil {
+		return false, err
+	}
+
+	b, err = NormalizeHTML(b, normalizations)
+	if err != nil {
+		return false, err
+	}
+
+	return a == b, nil
+}
@@ -0,0 +1,45 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHTML(t *testing.T) {
+	test := assert.New(t)
+
+	contents := "\n<p>a  b</p>\n\n<ul>\n  <li>c</li>\n</ul>\n" +
+		"<ac:plain-text-body><![CDATA[x\n\n  y]]></ac:plain-text-body>\n"
+
+	normalized, err := NormalizeHTML(contents, DefaultNormalizations)
+	test.NoError(err)
+	test.Equal(
+		"<p>a  b</p><ul><li>c</li></ul>"+
+			"<ac:plain-text-body><![CDATA[x\n\n  y]]></ac:plain-text-body>",
+		normalized,
+	)
+
+	normalized, err = NormalizeHTML(contents, []string{NormalizeSpaces})
+	test.NoError(err)
+	test.Equal(
+		" <p>a b</p> <ul> <li>c</li> </ul> "+
+			"<ac:plain-text-body><![CDATA[x\n\n  y]]></ac:plain-text-body> ",
+		normalized,
+	)
+
+	_, err = NormalizeHTML(contents, []string{"case"})
+	test.Error(err)
+
+	same, err := SameHTML("<p>a</p>\n<p>b</p>", "<p>a</p><p>b</p>\n", nil)
+	test.NoError(err)
+	test.False(same)
+
+	same, err = SameHTML(
+		"<p>a</p>\n<p>b</p>",
+		"<p>a</p><p>b</p>\n",
+		DefaultNormalizations,
+	)
+	test.NoError(err)
+	test.True(same)
+}
@@ -0,0 +1,104 @@
+package mark
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/reconquest/karma-go"
+)
+
+// LoadMetaDefaults reads headers or front matter of specified file, which
+// are used as defaults for metadata of every file, see Meta.Merge.
+func LoadMetaDefaults(path string) (*Meta, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, karma.Format(err, "unable to read metadata defaults")
+	}
+
+	defaults, _, err := ExtractMeta(data)
+	if err != nil {
+		return nil, karma.Format(
+			err,
+			"unable to parse metadata defaults %q",
+			path,
+		)
+	}
+
+	if defaults == nil {
+		return nil, fmt.Errorf("metadata defaults %q contain no headers", path)
+	}
+
+	return defaults, nil
+}
+
+// Merge fills fields, which are not set in metadata, from defaults. Title,
+// Type, Date and PageID identify the page and are never taken from defaults.
+// Parents are taken from defaults only if metadata has no Parent headers, so
+// ancestry is never mixed. Labels, Watchers and Attachments of defaults
+// replace empty lists only, unless mergeLists is set, in which case they are
+// added to lists of metadata.
+func (meta *Meta) Merge(defaults *Meta, mergeLists bool) {
+	if defaults == nil {
+		return
+	}
+
+	for _, field := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&meta.Space, defaults.Space},
+		{&meta.Layout, defaults.Layout},
+		{&meta.Prepend, defaults.Prepend},
+		{&meta.Append, defaults.Append},
+		{&meta.Appearance, defaults.Appearance},
+		{&meta.Status, defaults.Status},
+		{&meta.Author, defaults.Author},
+		{&meta.AttachmentsDir, defaults.AttachmentsDir},
+	} {
+		if *field.value == "" {
+			*field.value = field.fallback
+		}
+	}
+
+	// blog posts don't have parents
+	if len(meta.Parents) == 0 && meta.Type != TypeBlogPost {
+		meta.Parents = append([]string{}, defaults.Parents...)
+	}
+
+	if mergeLists || len(meta.Labels) == 0 {
+		meta.AddLabels(defaults.Labels...)
+	}
+
+	if mergeLists || len(meta.Watchers) == 0 {
+		watchers := map[string]bool{}
+		for _, watcher := range meta.Watchers {
+			watchers[watcher] = true
+		}
+
+		for _, watcher := range defaults.Watchers {
+			if !watchers[watcher] {
+				meta.Watchers = append(meta.Watchers, watcher)
+			}
+		}
+	}
+
+	if mergeLists || len(meta.Attachments) == 0 {
+		if meta.Attachments == nil {
+			meta.Attachments = map[string]string{}
+		}
+
+		if meta.OptionalAttachments == nil {
+			meta.OptionalAttachments = map[string]bool{}
+		}
+
+		for name, path := range defaults.Attachments {
+			if _, ok := meta.Attachments[name]; !ok {
+				meta.Attachments[name] = path
+
+				if defaults.OptionalAttachments[name] {
+					meta.OptionalAttachments[name] = true
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package mark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMetaDefaults(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "defaults.md")
+
+	test.NoError(ioutil.WriteFile(path, []byte(text(
+		"---",
+		"space: DOCS",
+		"parent: [Home, Guides]",
+		"label: [docs]",
+		"---",
+	)), 0644))
+
+	defaults, err := LoadMetaDefaults(path)
+	test.NoError(err)
+	test.Equal("DOCS", defaults.Space)
+	test.Equal([]string{"Home", "Guides"}, defaults.Parents)
+	test.Equal([]string{"docs"}, defaults.Labels)
+
+	test.NoError(ioutil.WriteFile(path, []byte("text\n"), 0644))
+
+	_, err = LoadMetaDefaults(path)
+	test.Error(err)
+}
+
+func TestMeta_Merge(t *testing.T) {
+	test := assert.New(t)
+
+	defaults := &Meta{
+		Space:       "DOCS",
+		Type:        TypePage,
+		Title:       "Defaults",
+		Layout:      "article",
+		Parents:     []string{"Home"},
+		Labels:      []string{"docs"},
+		Watchers:    []string{"alice"},
+		Attachments: map[string]string{"logo.png": "logo.png"},
+	}
+
+	meta := &Meta{
+		Space:       "OPS",
+		Type:        TypePage,
+		Title:       "Page",
+		Labels:      []string{"ops"},
+		Attachments: map[string]string{},
+	}
+
+	meta.Merge(defaults, false)
+
+	test.Equal("OPS", meta.Space)
+	test.Equal("Page", meta.Title)
+	test.Equal("article", meta.Layout)
+	test.Equal([]string{"Home"}, meta.Parents)
+	test.Equal([]string{"ops"}, meta.Labels)
+	test.Equal([]string{"alice"}, meta.Watchers)
+	test.Equal(map[string]string{"logo.png": "logo.png"}, meta.Attachments)
+
+	// defaults are not modified by merged metadata
+	meta.Parents[0] = "Changed"
+	test.Equal([]string{"Home"}, defaults.Parents)
+
+	meta = &Meta{
+		Type:     TypePage,
+		Parents:  []string{"Ops"},
+		Labels:   []string{"ops", "docs"},
+		Watchers: []string{"bob"},
+	}
+
+	meta.Merge(defaults, true)
+
+	test.Equal("DOCS", meta.Space)
+	test.Equal([]string{"Ops"}, meta.Parents)
+	test.Equal([]string{"ops", "docs"}, meta.Labels)
+	test.Equal([]string{"bob", "alice"}, meta.Watchers)
+	test.Equal(map[string]string{"logo.png": "logo.png"}, meta.Attachments)
+}
@@ -0,0 +1,63 @@
+package mark
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+	"github.com/reconquest/pkg/log"
+)
+
+// renderEmbed renders ```iframe and ```widget code blocks, which contain URL
+// of embedded page, as iframe macro and widget connector macro respectively.
+// It returns false if code block should be rendered as code instead.
+func (renderer ConfluenceRenderer) renderEmbed(
+	writer io.Writer,
+	node *bf.Node,
+	macro string,
+) bool {
+	link := strings.TrimSpace(string(node.Literal))
+
+	if !renderer.EmbedMacros {
+		log.Warningf(
+			nil,
+			"%s code block is rendered as code, "+
+				"because embedding is not enabled in configuration",
+			macro,
+		)
+
+		return false
+	}
+
+	uri, err := url.Parse(link)
+	if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") {
+		log.Warningf(
+			err,
+			"%s code block is rendered as code, "+
+				"because %q is not http or https URL",
+			macro,
+			link,
+		)
+
+		return false
+	}
+
+	params := ParseCodeParameters(string(node.Info))
+
+	renderer.Stdlib.Templates.ExecuteTemplate(
+		writer,
+		"ac:"+macro,
+		struct {
+			URL    string
+			Width  string
+			Height string
+		}{
+			escapeAttribute(link),
+			escapeAttribute(params["width"]),
+			escapeAttribute(params["height"]),
+		},
+	)
+
+	return true
+}
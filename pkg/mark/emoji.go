@@ -0,0 +1,68 @@
+package mark
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var reEmojiShortcode = regexp.MustCompile(`:([a-zA-Z0-9_+-]+):`)
+
+// CompileEmoji replaces :shortcode: references outside of code with emoticons
+// or images according to given map of shortcodes without colons. Values
+// which look like paths (contain dot or slash) are images, which are
+// returned to be attached to the page, other values are names of Confluence
+// emoticons like tick or warning.
+func CompileEmoji(
+	markdown []byte,
+	emoji map[string]string,
+) ([]byte, []string) {
+	if len(emoji) == 0 {
+		return markdown, nil
+	}
+
+	var (
+		result []byte
+		images []string
+		last   int
+	)
+
+	code := codeRanges(markdown)
+	attached := map[string]bool{}
+
+	for _, match := range reEmojiShortcode.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		name := string(markdown[match[2]:match[3]])
+
+		value, ok := emoji[name]
+		if !ok {
+			continue
+		}
+
+		var replacement string
+
+		if strings.ContainsAny(value, "./") {
+			replacement = fmt.Sprintf("![:%s:](%s)", name, value)
+
+			if !attached[value] {
+				images = append(images, value)
+				attached[value] = true
+			}
+		} else {
+			replacement = fmt.Sprintf(
+				`<ac:emoticon ac:name="%s" />`,
+				escapeAttribute(value),
+			)
+		}
+
+		result = append(result, markdown[last:match[0]]...)
+		result = append(result, replacement...)
+
+		last = match[1]
+	}
+
+	return append(result, markdown[last:]...), images
+}
@@ -0,0 +1,27 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileEmoji(t *testing.T) {
+	test := assert.New(t)
+
+	markdown, images := CompileEmoji(
+		[]byte("Done :ok: :shipit: :shipit: :unknown: `:ok:`\n"),
+		map[string]string{
+			"ok":     "tick",
+			"shipit": "images/shipit.png",
+		},
+	)
+
+	test.Equal(
+		`Done <ac:emoticon ac:name="tick" /> `+
+			`![:shipit:](images/shipit.png) ![:shipit:](images/shipit.png) `+
+			":unknown: `:ok:`\n",
+		string(markdown),
+	)
+	test.Equal([]string{"images/shipit.png"}, images)
+}
@@ -0,0 +1,164 @@
+package mark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// Encodings of markdown files which can be converted to UTF-8.
+const (
+	EncodingUTF8    = `utf-8`
+	EncodingUTF16LE = `utf-16le`
+	EncodingUTF16BE = `utf-16be`
+	EncodingLatin1  = `latin1`
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// DecodeInput converts markdown file contents to UTF-8. Encoding is detected
+// by byte order mark if file starts with it, otherwise given encoding is
+// used, which is UTF-8 if empty.
+func DecodeInput(data []byte, encoding string) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return data[len(bomUTF8):], nil
+
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian)
+
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian)
+	}
+
+	switch strings.ToLower(encoding) {
+	case "", EncodingUTF8, "utf8":
+		if !utf8.Valid(data) {
+			log.Warningf(
+				nil,
+				"file is not valid UTF-8, non-ASCII characters can be "+
+					"displayed incorrectly unless its encoding is specified",
+			)
+		}
+
+		return data, nil
+
+	case EncodingUTF16LE:
+		return decodeUTF16(data, binary.LittleEndian)
+
+	case EncodingUTF16BE:
+		return decodeUTF16(data, binary.BigEndian)
+
+	case EncodingLatin1, "iso-8859-1":
+		runes := make([]rune, len(data))
+		for i, char := range data {
+			runes[i] = rune(char)
+		}
+
+		return []byte(string(runes)), nil
+
+	default:
+		return nil, fmt.Errorf(
+			"unsupported encoding %q, expected one of: %s",
+			encoding,
+			strings.Join(
+				[]string{
+					EncodingUTF8,
+					EncodingUTF16LE,
+					EncodingUTF16BE,
+					EncodingLatin1,
+				},
+				", ",
+			),
+		)
+	}
+}
+
+// EncodeOutput converts UTF-8 contents back to encoding of original file
+// contents, detected the same way as in DecodeInput, keeping its byte order
+// mark.
+func EncodeOutput(
+	data []byte,
+	original []byte,
+	encoding string,
+) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(original, bomUTF8):
+		return append(append([]byte{}, bomUTF8...), data...), nil
+
+	case bytes.HasPrefix(original, bomUTF16LE):
+		return append(
+			append([]byte{}, bomUTF16LE...),
+			encodeUTF16(data, binary.LittleEndian)...,
+		), nil
+
+	case bytes.HasPrefix(original, bomUTF16BE):
+		return append(
+			append([]byte{}, bomUTF16BE...),
+			encodeUTF16(data, binary.BigEndian)...,
+		), nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "", EncodingUTF8, "utf8":
+		return data, nil
+
+	case EncodingUTF16LE:
+		return encodeUTF16(data, binary.LittleEndian), nil
+
+	case EncodingUTF16BE:
+		return encodeUTF16(data, binary.BigEndian), nil
+
+	case EncodingLatin1, "iso-8859-1":
+		result := make([]byte, 0, len(data))
+		for _, char := range string(data) {
+			if char > 0xFF {
+				return nil, fmt.Errorf(
+					"character %q can't be encoded in %s",
+					char,
+					EncodingLatin1,
+				)
+			}
+
+			result = append(result, byte(char))
+		}
+
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("file is not valid UTF-16: odd number of bytes")
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+
+	return []byte(string(utf16.Decode(units))), nil
+}
+
+func encodeUTF16(data []byte, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune(string(data)))
+
+	result := make([]byte, len(units)*2)
+	for i, unit := range units {
+		order.PutUint16(result[i*2:], unit)
+	}
+
+	return result
+}
@@ -0,0 +1,84 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeInput(t *testing.T) {
+	test := assert.New(t)
+
+	testcases := []struct {
+		data     []byte
+		encoding string
+	}{
+		{[]byte("<!-- Title: Café -->"), ""},
+		{append([]byte{0xEF, 0xBB, 0xBF}, "<!-- Title: Café -->"...), ""},
+		{[]byte("<!-- Title: Caf\xe9 -->"), "latin1"},
+		{
+			[]byte{
+				0xFF, 0xFE, '<', 0, '!', 0, '-', 0, '-', 0, ' ', 0,
+				'T', 0, 'i', 0, 't', 0, 'l', 0, 'e', 0, ':', 0, ' ', 0,
+				'C', 0, 'a', 0, 'f', 0, 0xE9, 0, ' ', 0,
+				'-', 0, '-', 0, '>', 0,
+			},
+			"",
+		},
+		{
+			[]byte{
+				0, '<', 0, '!', 0, '-', 0, '-', 0, ' ',
+				0, 'T', 0, 'i', 0, 't', 0, 'l', 0, 'e', 0, ':', 0, ' ',
+				0, 'C', 0, 'a', 0, 'f', 0, 0xE9, 0, ' ',
+				0, '-', 0, '-', 0, '>',
+			},
+			"utf-16be",
+		},
+	}
+
+	for _, testcase := range testcases {
+		data, err := DecodeInput(testcase.data, testcase.encoding)
+		test.NoError(err)
+		test.Equal("<!-- Title: Café -->", string(data))
+
+		data, err = EncodeOutput(data, testcase.data, testcase.encoding)
+		test.NoError(err)
+		test.Equal(testcase.data, data)
+	}
+
+	data, err := DecodeInput([]byte("Caf\xe9"), "")
+	test.NoError(err)
+	test.Equal("Caf\xe9", string(data))
+
+	_, err = DecodeInput([]byte("text"), "koi8-r")
+	test.Error(err)
+}
+
+func TestEncodeOutput_WriteBack(t *testing.T) {
+	test := assert.New(t)
+
+	original := []byte{
+		0xFF, 0xFE, '<', 0, '!', 0, '-', 0, '-', 0, ' ', 0,
+		'T', 0, 'i', 0, 't', 0, 'l', 0, 'e', 0, ':', 0, ' ', 0,
+		'C', 0, 'a', 0, 'f', 0, 0xE9, 0, ' ', 0,
+		'-', 0, '-', 0, '>', 0, '\n', 0,
+	}
+
+	data, err := DecodeInput(original, "")
+	test.NoError(err)
+
+	data = WriteBackHeaders(data, "123", 2, "https://example.com/123")
+
+	encoded, err := EncodeOutput(data, original, "")
+	test.NoError(err)
+	test.Equal([]byte{0xFF, 0xFE}, encoded[:2])
+
+	decoded, err := DecodeInput(encoded, "")
+	test.NoError(err)
+	test.Equal(string(data), string(decoded))
+	test.Contains(string(decoded), "PageID: 123")
+	test.Contains(string(decoded), "Title: Café")
+
+	_, err = EncodeOutput([]byte("Привет"), []byte("text"), "latin1")
+	test.Error(err)
+}
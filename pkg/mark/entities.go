@@ -0,0 +1,146 @@
+package mark
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	reEscapedEntity = regexp.MustCompile(
+		`&amp;(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`,
+	)
+
+	reBackslashEntity = regexp.MustCompile(
+		`\\&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`,
+	)
+
+	reCodeElement = regexp.MustCompile(
+		`(?s)<code\b[^>]*>.*?</code>|<pre\b[^>]*>.*?</pre>`,
+	)
+)
+
+// NormalizeEntities unescapes entities which were escaped twice (like
+// &amp;lt;), so pre-escaped entities from markdown are displayed as intended
+// instead of being shown literally. Contents of CDATA sections, <code> and
+// <pre> elements are never changed. If strict is set, contents are returned as
+// is.
+func NormalizeEntities(contents string, strict bool) string {
+	if strict {
+		return contents
+	}
+
+	return replaceOutsideCDATA(contents, func(contents string) string {
+		return replaceOutsideCode(contents, unescapeEntities)
+	})
+}
+
+// escapeEntityEscapes doubles escaping of backslash-escaped entities (like
+// \&lt;) outside of code in markdown, so they are still displayed literally
+// after NormalizeEntities.
+func escapeEntityEscapes(markdown []byte) []byte {
+	var (
+		code   = codeRanges(markdown)
+		buffer bytes.Buffer
+		offset int
+	)
+
+	for _, match := range reBackslashEntity.FindAllIndex(markdown, -1) {
+		if insideRanges(code, match[0]) || escapedBackslash(markdown, match[0]) {
+			continue
+		}
+
+		buffer.Write(markdown[offset : match[0]+len(`\&`)])
+		buffer.WriteString("amp;")
+
+		offset = match[0] + len(`\&`)
+	}
+
+	buffer.Write(markdown[offset:])
+
+	return buffer.Bytes()
+}
+
+// escapedBackslash reports whether backslash at offset is escaped itself by
+// odd number of preceding backslashes.
+func escapedBackslash(markdown []byte, offset int) bool {
+	count := 0
+	for offset > 0 && markdown[offset-1] == '\\' {
+		count++
+		offset--
+	}
+
+	return count%2 == 1
+}
+
+// replaceOutsideCode applies replace to every part of contents which is not
+// <code> or <pre> element.
+func replaceOutsideCode(
+	contents string,
+	replace func(string) string,
+) string {
+	var (
+		result strings.Builder
+		offset int
+	)
+
+	for _, element := range reCodeElement.FindAllStringIndex(contents, -1) {
+		result.WriteString(replace(contents[offset:element[0]]))
+		result.WriteString(contents[element[0]:element[1]])
+
+		offset = element[1]
+	}
+
+	result.WriteString(replace(contents[offset:]))
+
+	return result.String()
+}
+
+// replaceOutsideCDATA applies replace to every part of contents which is not
+// CDATA section.
+func replaceOutsideCDATA(
+	contents string,
+	replace func(string) string,
+) string {
+	var result strings.Builder
+
+	for {
+		start := strings.Index(contents, "<![CDATA[")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(contents[start:], "]]>")
+		if end < 0 {
+			break
+		}
+
+		end += start + len("]]>")
+
+		result.WriteString(replace(contents[:start]))
+		result.WriteString(contents[start:end])
+
+		contents = contents[end:]
+	}
+
+	result.WriteString(replace(contents))
+
+	return result.String()
+}
+
+func unescapeEntities(contents string) string {
+	return reEscapedEntity.ReplaceAllStringFunc(
+		contents,
+		func(match string) string {
+			entity := "&" + match[len("&amp;"):]
+
+			// unknown entities are kept escaped
+			if html.UnescapeString(entity) == entity {
+				return match
+			}
+
+			return entity
+		},
+	)
+}
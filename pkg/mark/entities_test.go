@@ -0,0 +1,45 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEntities(t *testing.T) {
+	test := assert.New(t)
+
+	testcases := []struct {
+		contents string
+		strict   bool
+		expected string
+	}{
+		{"a &amp; b", false, "a &amp; b"},
+		{"a &amp;amp; b", false, "a &amp; b"},
+		{"&amp;lt;tag&amp;gt;", false, "&lt;tag&gt;"},
+		{"&amp;quot;quoted&amp;quot;", false, "&quot;quoted&quot;"},
+		{"&amp;#8212; &amp;#x2014;", false, "&#8212; &#x2014;"},
+		{"&amp;eacute;t&eacute;", false, "&eacute;t&eacute;"},
+		{"&amp;unknown; entity", false, "&amp;unknown; entity"},
+		{"Über straße", false, "Über straße"},
+		{"&amp;lt;tag&amp;gt;", true, "&amp;lt;tag&amp;gt;"},
+		{
+			"&amp;amp; <![CDATA[&amp;amp; &copy;]]> &amp;copy;",
+			false,
+			"&amp; <![CDATA[&amp;amp; &copy;]]> &copy;",
+		},
+		{
+			"&amp;lt; <code>&amp;lt;</code> <pre class=\"x\">&amp;gt;</pre>",
+			false,
+			"&lt; <code>&amp;lt;</code> <pre class=\"x\">&amp;gt;</pre>",
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Equal(
+			testcase.expected,
+			NormalizeEntities(testcase.contents, testcase.strict),
+			testcase.contents,
+		)
+	}
+}
@@ -0,0 +1,130 @@
+package mark
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultIndexFilenames are names of files, pages of which become pages of
+// their directories, see Folders.
+var DefaultIndexFilenames = []string{"index.md", "README.md"}
+
+// Folders tracks pages of directories, which are created from index files
+// like docs/setup/index.md, so pages of other files in the directory and in
+// its subdirectories are created under the page of the directory.
+type Folders struct {
+	mutex sync.Mutex
+
+	names map[string]bool
+	pages map[string]string
+}
+
+func NewFolders(names []string) *Folders {
+	folders := &Folders{
+		names: map[string]bool{},
+		pages: map[string]string{},
+	}
+
+	for _, name := range names {
+		folders.names[strings.ToLower(name)] = true
+	}
+
+	return folders
+}
+
+// IsIndex reports whether given file is index file of its directory, names
+// of index files are case insensitive.
+func (folders *Folders) IsIndex(file string) bool {
+	return folders.names[strings.ToLower(filepath.Base(file))]
+}
+
+// Order splits files into groups, which should be processed one after
+// another: index files go first, sorted by depth, so pages of directories
+// exist before pages of their contents are created.
+func (folders *Folders) Order(files []string) [][]string {
+	var (
+		depths = map[int][]string{}
+		levels = []int{}
+		rest   = []string{}
+	)
+
+	for _, file := range files {
+		if !folders.IsIndex(file) {
+			rest = append(rest, file)
+
+			continue
+		}
+
+		depth := strings.Count(filepath.ToSlash(filepath.Clean(file)), "/")
+		if _, ok := depths[depth]; !ok {
+			levels = append(levels, depth)
+		}
+
+		depths[depth] = append(depths[depth], file)
+	}
+
+	sort.Ints(levels)
+
+	groups := [][]string{}
+	for _, depth := range levels {
+		groups = append(groups, depths[depth])
+	}
+
+	if len(rest) > 0 {
+		groups = append(groups, rest)
+	}
+
+	return groups
+}
+
+// Set records ID of the page created from given index file as page of its
+// directory.
+func (folders *Folders) Set(file string, pageID string) {
+	if folders == nil || pageID == "" || !folders.IsIndex(file) {
+		return
+	}
+
+	folders.mutex.Lock()
+	defer folders.mutex.Unlock()
+
+	folders.pages[filepath.Dir(filepath.Clean(file))] = pageID
+}
+
+// Parent returns ID of the page of the closest directory containing given
+// file. Index file itself is placed under the page of parent directory.
+func (folders *Folders) Parent(file string) (string, bool) {
+	if folders == nil {
+		return "", false
+	}
+
+	folders.mutex.Lock()
+	defer folders.mutex.Unlock()
+
+	dir := filepath.Dir(filepath.Clean(file))
+	if folders.IsIndex(file) {
+		dir = parentDir(dir)
+	}
+
+	for dir != "" {
+		if id, ok := folders.pages[dir]; ok {
+			return id, true
+		}
+
+		dir = parentDir(dir)
+	}
+
+	return "", false
+}
+
+// parentDir returns parent of given directory, or empty string if there is
+// no parent.
+func parentDir(dir string) string {
+	parent := filepath.Dir(dir)
+	if parent == dir {
+		return ""
+	}
+
+	return parent
+}
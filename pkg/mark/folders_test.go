@@ -0,0 +1,57 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolders(t *testing.T) {
+	test := assert.New(t)
+
+	folders := NewFolders(DefaultIndexFilenames)
+
+	test.Equal(
+		[][]string{
+			{"readme.md"},
+			{"docs/index.md"},
+			{"docs/setup/README.md"},
+			{"docs/intro.md", "docs/setup/install.md", "other/page.md"},
+		},
+		folders.Order([]string{
+			"docs/index.md",
+			"docs/intro.md",
+			"docs/setup/README.md",
+			"docs/setup/install.md",
+			"other/page.md",
+			"readme.md",
+		}),
+	)
+
+	folders.Set("docs/intro.md", "1")
+	folders.Set("docs/index.md", "10")
+	folders.Set("docs/setup/README.md", "20")
+
+	_, ok := folders.Parent("docs/index.md")
+	test.False(ok)
+
+	parent, ok := folders.Parent("docs/setup/README.md")
+	test.True(ok)
+	test.Equal("10", parent)
+
+	parent, ok = folders.Parent("docs/intro.md")
+	test.True(ok)
+	test.Equal("10", parent)
+
+	parent, ok = folders.Parent("docs/setup/advanced/tuning.md")
+	test.True(ok)
+	test.Equal("20", parent)
+
+	_, ok = folders.Parent("other/page.md")
+	test.False(ok)
+
+	var disabled *Folders
+
+	_, ok = disabled.Parent("docs/intro.md")
+	test.False(ok)
+}
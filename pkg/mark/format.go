@@ -0,0 +1,309 @@
+package mark
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Formats of compiled page, which can be applied by FormatHTML.
+const (
+	// HTMLFormatPretty puts every block element on its own line, indented
+	// by its nesting level.
+	HTMLFormatPretty = `pretty`
+
+	// HTMLFormatMinify removes whitespace around block elements.
+	HTMLFormatMinify = `minify`
+)
+
+var reHTMLToken = regexp.MustCompile(
+	`(?s)<!\[CDATA\[.*?\]\]>|<!--.*?-->|<[^<>]*>|[^<]+|<`,
+)
+
+// htmlBlockTags are elements, whitespace around which is insignificant.
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "blockquote": true, "hr": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"table": true, "thead": true, "tbody": true, "tfoot": true, "tr": true,
+	"th": true, "td": true, "caption": true, "colgroup": true, "col": true,
+	"section": true, "article": true, "aside": true, "figure": true,
+	"figcaption": true, "details": true, "summary": true,
+
+	"ac:layout":          true,
+	"ac:layout-section":  true,
+	"ac:layout-cell":     true,
+	"ac:parameter":       true,
+	"ac:rich-text-body":  true,
+	"ac:plain-text-body": true,
+	"ac:task-list":       true,
+	"ac:task":            true,
+	"ac:task-id":         true,
+	"ac:task-status":     true,
+	"ac:task-body":       true,
+}
+
+// htmlVerbatimTags are elements, contents of which are never changed.
+var htmlVerbatimTags = map[string]bool{
+	"pre":                true,
+	"ac:parameter":       true,
+	"ac:plain-text-body": true,
+}
+
+type htmlToken struct {
+	text string
+
+	name    string
+	closing bool
+	empty   bool
+	block   bool
+
+	// whitespace is set for text consisting only of whitespace outside of
+	// verbatim elements.
+	whitespace bool
+}
+
+// FormatHTML formats compiled page in given format deterministically without
+// changing its meaning: whitespace is removed or added only around block
+// elements, and contents of CDATA sections, <pre> elements and macro
+// parameters are left as is.
+func FormatHTML(html string, format string) (string, error) {
+	switch format {
+	case "":
+		return html, nil
+
+	case HTMLFormatMinify:
+		return minifyHTML(tokenizeHTML(html)), nil
+
+	case HTMLFormatPretty:
+		return prettifyHTML(tokenizeHTML(html)), nil
+
+	default:
+		return "", fmt.Errorf(
+			"unknown HTML format %q, expected %s or %s",
+			format,
+			HTMLFormatPretty,
+			HTMLFormatMinify,
+		)
+	}
+}
+
+func tokenizeHTML(html string) []htmlToken {
+	var (
+		tokens   = []htmlToken{}
+		opened   = []int{}
+		macros   = [][2]int{}
+		verbatim = 0
+		block    = true
+	)
+
+	for _, text := range reHTMLToken.FindAllString(html, -1) {
+		token := htmlToken{text: text}
+
+		if !strings.HasPrefix(text, "<") {
+			token.whitespace = verbatim == 0 && strings.TrimSpace(text) == ""
+			if !token.whitespace {
+				block = false
+			}
+
+			tokens = append(tokens, token)
+
+			continue
+		}
+
+		if len(text) < 3 || strings.HasPrefix(text, "<!") {
+			block = false
+			tokens = append(tokens, token)
+
+			continue
+		}
+
+		fields := strings.FieldsFunc(
+			strings.TrimPrefix(text[1:], "/"),
+			func(r rune) bool {
+				return r == ' ' || r == '\t' || r == '\n' || r == '/' || r == '>'
+			},
+		)
+		if len(fields) == 0 {
+			block = false
+			tokens = append(tokens, token)
+
+			continue
+		}
+
+		token.name = strings.ToLower(fields[0])
+		token.closing = strings.HasPrefix(text, "</")
+		token.empty = strings.HasSuffix(text, "/>")
+
+		// macros are block elements only if they are placed between other
+		// block elements, like code macro, otherwise they are inline along
+		// with their parameters, like status macro inside paragraph
+		token.block = htmlBlockTags[token.name] ||
+			(token.name == "ac:structured-macro" && block)
+
+		if len(opened) > 0 {
+			parent := tokens[opened[len(opened)-1]]
+			if parent.name == "ac:structured-macro" && !parent.block {
+				token.block = false
+			}
+		}
+
+		if token.closing {
+			for i := len(opened) - 1; i >= 0; i-- {
+				if tokens[opened[i]].name == token.name {
+					token.block = tokens[opened[i]].block
+
+					if token.name == "ac:structured-macro" && token.block {
+						macros = append(macros, [2]int{opened[i], len(tokens)})
+					}
+
+					opened = opened[:i]
+
+					break
+				}
+			}
+
+			if htmlVerbatimTags[token.name] && verbatim > 0 {
+				verbatim--
+			}
+		} else if !token.empty {
+			opened = append(opened, len(tokens))
+
+			if htmlVerbatimTags[token.name] {
+				verbatim++
+			}
+		}
+
+		block = token.block
+
+		tokens = append(tokens, token)
+	}
+
+	// macros followed by inline contents, like status macro at the start of
+	// paragraph, are inline as well
+	for _, macro := range macros {
+		for _, next := range tokens[macro[1]+1:] {
+			if next.whitespace {
+				continue
+			}
+
+			if !next.block {
+				for i := macro[0]; i <= macro[1]; i++ {
+					if tokens[i].name == "ac:structured-macro" ||
+						tokens[i].name == "ac:parameter" {
+						tokens[i].block = false
+					}
+				}
+			}
+
+			break
+		}
+	}
+
+	return tokens
+}
+
+func minifyHTML(tokens []htmlToken) string {
+	var buffer strings.Builder
+
+	for i, token := range tokens {
+		if token.whitespace {
+			var previous, next htmlToken
+
+			if i > 0 {
+				previous = tokens[i-1]
+			}
+
+			if i < len(tokens)-1 {
+				next = tokens[i+1]
+			}
+
+			if i == 0 || i == len(tokens)-1 || previous.block || next.block {
+				continue
+			}
+		}
+
+		buffer.WriteString(token.text)
+	}
+
+	return buffer.String()
+}
+
+func prettifyHTML(tokens []htmlToken) string {
+	var (
+		buffer strings.Builder
+
+		// nested tracks whether opened block elements contain other block
+		// elements, so their closing tags are put on separate lines
+		nested   = []bool{}
+		verbatim = 0
+	)
+
+	minified := tokenizeHTML(minifyHTML(tokens))
+
+	for _, token := range minified {
+		if verbatim > 0 {
+			switch {
+			case token.closing && htmlVerbatimTags[token.name]:
+				verbatim--
+
+				if verbatim == 0 && len(nested) > 0 {
+					nested = nested[:len(nested)-1]
+				}
+
+			case !token.closing && !token.empty && htmlVerbatimTags[token.name]:
+				verbatim++
+			}
+
+			buffer.WriteString(token.text)
+
+			continue
+		}
+
+		if !token.block {
+			buffer.WriteString(token.text)
+
+			continue
+		}
+
+		if token.closing {
+			if len(nested) > 0 {
+				if nested[len(nested)-1] {
+					buffer.WriteString("\n")
+					buffer.WriteString(strings.Repeat("  ", len(nested)-1))
+				}
+
+				nested = nested[:len(nested)-1]
+			}
+
+			buffer.WriteString(token.text)
+
+			continue
+		}
+
+		if len(nested) > 0 {
+			nested[len(nested)-1] = true
+		}
+
+		if buffer.Len() > 0 {
+			buffer.WriteString("\n")
+			buffer.WriteString(strings.Repeat("  ", len(nested)))
+		}
+
+		buffer.WriteString(token.text)
+
+		if !token.empty {
+			nested = append(nested, false)
+
+			if htmlVerbatimTags[token.name] {
+				verbatim++
+			}
+		}
+	}
+
+	if buffer.Len() > 0 {
+		buffer.WriteString("\n")
+	}
+
+	return buffer.String()
+}
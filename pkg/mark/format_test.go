@@ -0,0 +1,78 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatHTML(t *testing.T) {
+	test := assert.New(t)
+
+	html := text(
+		`<h1 id="a">Title</h1>`,
+		"",
+		`<p><ac:structured-macro ac:name="status"><ac:parameter ac:name="title">A</ac:parameter></ac:structured-macro> <b>B</b></p>`,
+		`<p>Status: <ac:structured-macro ac:name="status"><ac:parameter ac:name="title">A  B</ac:parameter></ac:structured-macro> <b>done</b></p>`,
+		"",
+		`<ul>`,
+		`<li>one <em>x</em></li>`,
+		`<li>two</li>`,
+		`</ul>`,
+		"",
+		`<ac:structured-macro ac:name="code">`,
+		`<ac:parameter ac:name="language">go</ac:parameter>`,
+		`<ac:plain-text-body><![CDATA[a  `,
+		`  <p> b]]></ac:plain-text-body>`,
+		`</ac:structured-macro>`,
+		"",
+		`<pre>  x`,
+		`  <b>y</b> </pre>`,
+		"",
+	)
+
+	minified, err := FormatHTML(html, HTMLFormatMinify)
+	test.NoError(err)
+	test.Equal(
+		`<h1 id="a">Title</h1>`+
+			`<p><ac:structured-macro ac:name="status"><ac:parameter ac:name="title">A</ac:parameter></ac:structured-macro> <b>B</b></p>`+
+			`<p>Status: <ac:structured-macro ac:name="status"><ac:parameter ac:name="title">A  B</ac:parameter></ac:structured-macro> <b>done</b></p>`+
+			`<ul><li>one <em>x</em></li><li>two</li></ul>`+
+			`<ac:structured-macro ac:name="code">`+
+			`<ac:parameter ac:name="language">go</ac:parameter>`+
+			"<ac:plain-text-body><![CDATA[a  \n  <p> b]]></ac:plain-text-body>"+
+			`</ac:structured-macro>`+
+			"<pre>  x\n  <b>y</b> </pre>",
+		minified,
+	)
+
+	pretty, err := FormatHTML(html, HTMLFormatPretty)
+	test.NoError(err)
+	test.Equal(
+		text(
+			`<h1 id="a">Title</h1>`,
+			`<p><ac:structured-macro ac:name="status"><ac:parameter ac:name="title">A</ac:parameter></ac:structured-macro> <b>B</b></p>`,
+			`<p>Status: <ac:structured-macro ac:name="status"><ac:parameter ac:name="title">A  B</ac:parameter></ac:structured-macro> <b>done</b></p>`,
+			`<ul>`,
+			`  <li>one <em>x</em></li>`,
+			`  <li>two</li>`,
+			`</ul>`,
+			`<ac:structured-macro ac:name="code">`,
+			`  <ac:parameter ac:name="language">go</ac:parameter>`,
+			`  <ac:plain-text-body><![CDATA[a  `,
+			`  <p> b]]></ac:plain-text-body>`,
+			`</ac:structured-macro>`,
+			`<pre>  x`,
+			`  <b>y</b> </pre>`,
+			"",
+		),
+		pretty,
+	)
+
+	again, err := FormatHTML(pretty, HTMLFormatPretty)
+	test.NoError(err)
+	test.Equal(pretty, again)
+
+	_, err = FormatHTML(html, "compact")
+	test.Error(err)
+}
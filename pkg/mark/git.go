@@ -0,0 +1,124 @@
+package mark
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// Git describes state of git repository around markdown file, it's
+// available in templates as .Git.
+type Git struct {
+	// Commit is a hash of HEAD commit.
+	Commit string
+
+	// Branch is a name of current branch, it's empty if HEAD is detached.
+	Branch string
+}
+
+// ReadGit returns state of git repository containing specified file, fields
+// are empty if file is not in git repository or git is not installed.
+func ReadGit(path string) Git {
+	dir := filepath.Dir(path)
+
+	git := func(args ...string) string {
+		output, err := exec.Command(
+			"git",
+			append([]string{"-C", dir}, args...)...,
+		).Output()
+		if err != nil {
+			log.Debugf(nil, "unable to read git info of %s: %s", path, err)
+
+			return ""
+		}
+
+		return strings.TrimSpace(string(output))
+	}
+
+	info := Git{
+		Commit: git("rev-parse", "HEAD"),
+	}
+
+	if info.Commit == "" {
+		return info
+	}
+
+	info.Branch = git("rev-parse", "--abbrev-ref", "HEAD")
+	if info.Branch == "HEAD" {
+		info.Branch = ""
+	}
+
+	return info
+}
+
+// SourceUpdatedProperty is a key of content property, which holds date of
+// last change of page source, see SourceUpdated.
+const SourceUpdatedProperty = "source-updated"
+
+// SourcePathProperty is a key of content property, which holds path of
+// markdown file the page is created from.
+const SourcePathProperty = "source-path"
+
+// SourcePath returns path of file, which identifies page source regardless
+// of working directory and operating system. Path is relative to the root of
+// git repository containing the file, or absolute if file is not in git
+// repository.
+func SourcePath(file string) string {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(file))
+	}
+
+	output, err := exec.Command(
+		"git",
+		"-C", filepath.Dir(path),
+		"rev-parse", "--show-toplevel",
+	).Output()
+	if err != nil {
+		log.Debugf(nil, "unable to find git repository of %s: %s", file, err)
+
+		return filepath.ToSlash(path)
+	}
+
+	// root of repository is reported with symlinks resolved
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	relative, err := filepath.Rel(strings.TrimSpace(string(output)), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+// SourceUpdated returns date of last commit changing specified file, or
+// modification time of the file if it's not committed to git repository.
+func SourceUpdated(path string) (time.Time, error) {
+	output, err := exec.Command(
+		"git",
+		"-C", filepath.Dir(path),
+		"log", "-1", "--format=%cI", "--", filepath.Base(path),
+	).Output()
+	if err == nil && len(strings.TrimSpace(string(output))) > 0 {
+		return time.Parse(time.RFC3339, strings.TrimSpace(string(output)))
+	}
+
+	log.Debugf(
+		nil,
+		"unable to read git history of %s, using modification time",
+		path,
+	)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
@@ -0,0 +1,90 @@
+package mark
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadGit_NotRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark-git")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, Git{}, ReadGit(filepath.Join(dir, "page.md")))
+}
+
+func TestSourceUpdated_NotRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mark-git")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "page.md")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("# Page\n"), 0644))
+
+	modified := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+
+	updated, err := SourceUpdated(path)
+	assert.NoError(t, err)
+	assert.True(t, modified.Equal(updated))
+
+	_, err = SourceUpdated(filepath.Join(dir, "missing.md"))
+	assert.Error(t, err)
+}
+
+func TestSourcePath(t *testing.T) {
+	test := assert.New(t)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "mark-git")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	test.NoError(os.MkdirAll(filepath.Join(dir, "repo", "docs"), 0755))
+	test.NoError(
+		exec.Command("git", "init", "-q", filepath.Join(dir, "repo")).Run(),
+	)
+
+	workdir, err := os.Getwd()
+	test.NoError(err)
+
+	defer os.Chdir(workdir)
+
+	// the same file is the same source regardless of working directory
+	for _, testcase := range []struct {
+		workdir string
+		file    string
+	}{
+		{"repo", "docs/page.md"},
+		{"repo", "./docs/../docs/page.md"},
+		{"repo/docs", "page.md"},
+		{".", "repo/docs/page.md"},
+	} {
+		test.NoError(os.Chdir(filepath.Join(dir, testcase.workdir)))
+		test.Equal("docs/page.md", SourcePath(testcase.file), testcase)
+	}
+
+	test.NoError(os.MkdirAll(filepath.Join(dir, "plain"), 0755))
+	test.NoError(os.Chdir(filepath.Join(dir, "plain")))
+
+	absolute, err := filepath.Abs("page.md")
+	test.NoError(err)
+
+	test.Equal(filepath.ToSlash(absolute), SourcePath("page.md"))
+
+	test.NoError(os.Chdir(dir))
+	test.Equal(filepath.ToSlash(absolute), SourcePath("plain/page.md"))
+}
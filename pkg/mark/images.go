@@ -0,0 +1,139 @@
+package mark
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+	"github.com/reconquest/pkg/log"
+)
+
+// reImageAttributes matches attributes block following image like
+// ![screenshot](screen.png){width=300 border align=center thumbnail}.
+var reImageAttributes = regexp.MustCompile(`^\{([^{}\n]*)\}`)
+
+// reAttachmentDownload matches download link of attachment, which local
+// images are replaced with, see CompileAttachmentLinks.
+var reAttachmentDownload = regexp.MustCompile(
+	`/download/attachments/\d+/([^/?]+)`,
+)
+
+// imageAttributes maps attributes of image to attributes of ac:image.
+var imageAttributes = map[string]string{
+	"width":     "ac:width",
+	"height":    "ac:height",
+	"border":    "ac:border",
+	"align":     "ac:align",
+	"thumbnail": "ac:thumbnail",
+}
+
+// parseImageAttributes parses attributes block, which follows given image,
+// and removes it from the text. Attributes are specified as key=value or
+// just key for boolean ones, unknown attributes are reported and ignored.
+// Returns nil if image isn't followed by attributes block.
+func parseImageAttributes(image *bf.Node) []string {
+	text := image.Next
+	if text == nil || text.Type != bf.Text {
+		return nil
+	}
+
+	match := reImageAttributes.FindSubmatchIndex(text.Literal)
+	if match == nil {
+		return nil
+	}
+
+	attributes := []string{}
+
+	for _, field := range strings.Fields(string(text.Literal[match[2]:match[3]])) {
+		key, value := field, "true"
+		if index := strings.Index(field, "="); index >= 0 {
+			key, value = field[:index], strings.Trim(field[index+1:], `"'`)
+		}
+
+		name, ok := imageAttributes[strings.ToLower(key)]
+		if !ok {
+			log.Warningf(nil, "unknown image attribute %q is ignored", key)
+
+			continue
+		}
+
+		switch name {
+		case "ac:width", "ac:height":
+			value = strings.TrimSuffix(value, "px")
+
+		case "ac:align":
+			value = strings.ToLower(value)
+			if value != "left" && value != "center" && value != "right" {
+				log.Warningf(
+					nil,
+					"unexpected image alignment %q, "+
+						"expected left, center or right",
+					value,
+				)
+
+				continue
+			}
+		}
+
+		attributes = append(
+			attributes,
+			fmt.Sprintf(`%s="%s"`, name, escapeAttribute(value)),
+		)
+	}
+
+	text.Literal = text.Literal[match[1]:]
+
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	return attributes
+}
+
+// isSVGAttachment checks that given image is SVG image uploaded as attachment
+// of the page.
+func isSVGAttachment(image *bf.Node) bool {
+	match := reAttachmentDownload.FindSubmatch(image.LinkData.Destination)
+
+	return match != nil &&
+		strings.EqualFold(filepath.Ext(string(match[1])), ".svg")
+}
+
+// renderImage renders image with attributes as ac:image, images uploaded as
+// attachments of the page are referenced by file name, so thumbnails are
+// rendered by Confluence.
+func (renderer ConfluenceRenderer) renderImage(
+	writer io.Writer,
+	node *bf.Node,
+	attributes []string,
+) {
+	var (
+		source   = string(node.LinkData.Destination)
+		resource = fmt.Sprintf(`<ri:url ri:value="%s" />`, escapeAttribute(source))
+	)
+
+	if match := reAttachmentDownload.FindStringSubmatch(source); match != nil {
+		filename := match[1]
+		if unescaped, err := url.PathUnescape(filename); err == nil {
+			filename = unescaped
+		}
+
+		resource = fmt.Sprintf(
+			`<ri:attachment ri:filename="%s" />`,
+			escapeAttribute(filename),
+		)
+	}
+
+	fmt.Fprintf(
+		writer,
+		`<ac:image ac:alt="%s" ac:title="%s"%s>%s</ac:image>`,
+		escapeAttribute(nodeText(node)),
+		escapeAttribute(string(node.LinkData.Title)),
+		strings.Join(append([]string{""}, attributes...), " "),
+		resource,
+	)
+}
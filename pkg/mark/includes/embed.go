@@ -0,0 +1,120 @@
+package includes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+)
+
+// <!-- Embed: <url> [lang=<language>] -->
+var reEmbedDirective = regexp.MustCompile(
+	`<!--\s*Embed:\s*(\S+)([^\n]*?)\s*-->`,
+)
+
+// EmbedTimeout limits time of fetching every embedded file.
+var EmbedTimeout = 30 * time.Second
+
+// embeds caches contents of fetched files for the run, so file embedded into
+// many pages is fetched only once.
+var embeds = struct {
+	sync.Mutex
+	contents map[string]string
+}{contents: map[string]string{}}
+
+// ProcessEmbeds replaces embed directives with contents of files fetched by
+// given URLs, which are always wrapped into fenced code block, unlike
+// templates included using include directive. Supported options:
+//   - lang=<language>: language of code block.
+func ProcessEmbeds(contents []byte) ([]byte, error) {
+	var err error
+
+	contents = reEmbedDirective.ReplaceAllFunc(
+		contents,
+		func(spec []byte) []byte {
+			if err != nil {
+				return nil
+			}
+
+			var (
+				groups  = reEmbedDirective.FindSubmatch(spec)
+				link    = string(groups[1])
+				options = strings.Fields(string(groups[2]))
+				lang    string
+			)
+
+			for _, option := range options {
+				parts := strings.SplitN(option, "=", 2)
+				if len(parts) != 2 || parts[0] != "lang" {
+					err = fmt.Errorf(
+						"unknown embed option %q of %q",
+						option,
+						link,
+					)
+
+					return nil
+				}
+
+				lang = parts[1]
+			}
+
+			var code string
+
+			code, err = fetchEmbed(link)
+			if err != nil {
+				err = karma.Format(err, "unable to embed %q", link)
+
+				return nil
+			}
+
+			return fenceCode(strings.TrimSuffix(code, "\n"), lang)
+		},
+	)
+
+	return contents, err
+}
+
+func fetchEmbed(link string) (string, error) {
+	uri, err := url.Parse(link)
+	if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") {
+		return "", fmt.Errorf("expected http or https URL")
+	}
+
+	embeds.Lock()
+	defer embeds.Unlock()
+
+	if code, ok := embeds.contents[link]; ok {
+		return code, nil
+	}
+
+	log.Debugf(nil, "fetching embedded file %q", link)
+
+	client := &http.Client{Timeout: EmbedTimeout}
+
+	response, err := client.Get(link)
+	if err != nil {
+		return "", karma.Format(err, "unable to fetch file")
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected response status %q", response.Status)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", karma.Format(err, "unable to read response")
+	}
+
+	embeds.contents[link] = string(body)
+
+	return string(body), nil
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
@@ -15,14 +18,54 @@ import (
 	"github.com/reconquest/pkg/log"
 )
 
-// <!-- Include: <template path>
+// BuildTime is the time when mark was started, it's available in templates
+// as .BuildTime, so every generated page is stamped with the same time.
+var BuildTime = time.Now()
+
+// SetVars adds variables which are available in every template, like
+// .BuildTime, to template data unless data has them already.
+func SetVars(data map[string]interface{}, vars map[string]interface{}) {
+	for key, value := range vars {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+}
+
+// LoadData reads variables, which are available in every template, from
+// specified YAML file.
+func LoadData(path string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, karma.Format(err, "unable to read data file")
+	}
+
+	data := map[string]interface{}{}
+
+	err = yaml.Unmarshal(contents, &data)
+	if err != nil {
+		return nil, karma.Format(err, "unable to decode data file %q", path)
+	}
+
+	return data, nil
+}
+
+// <!-- Include: <template path> [<option>=<value>...]
 //      <optional yaml data> -->
 var reIncludeDirective = regexp.MustCompile(
-	`(?s)<!--\s*Include:\s*(?P<template>\S+)\s*(\n(?P<config>.*?))?-->`)
+	`(?s)<!--\s*Include:\s*(?P<template>\S+)(?P<options>[^\n]*?)\s*` +
+		`(\n(?P<config>.*?))?-->`)
 
+// <path>:<first line>-<last line>
+var reLineRange = regexp.MustCompile(`^(.+):(\d+)-(\d+)$`)
+
+// LoadTemplate returns template with given name, loading it from file if it's
+// not defined yet. Template file is looked up relative to current directory
+// first, and then relative to given directories in order.
 func LoadTemplate(
 	path string,
 	templates *template.Template,
+	dirs ...string,
 ) (*template.Template, error) {
 	var (
 		name  = strings.TrimSuffix(path, filepath.Ext(path))
@@ -35,7 +78,7 @@ func LoadTemplate(
 
 	var body []byte
 
-	body, err := ioutil.ReadFile(path)
+	body, err := ioutil.ReadFile(findTemplate(path, dirs))
 	if err != nil {
 		err = facts.Format(
 			err,
@@ -58,9 +101,29 @@ func LoadTemplate(
 	return templates, nil
 }
 
+func findTemplate(path string, dirs []string) string {
+	if _, err := os.Stat(path); err == nil || filepath.IsAbs(path) {
+		return path
+	}
+
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, path)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+
+	return path
+}
+
+// ProcessIncludes replaces include directives with contents of included
+// templates, which are looked up in given directories as well, see
+// LoadTemplate.
 func ProcessIncludes(
 	contents []byte,
 	templates *template.Template,
+	vars map[string]interface{},
+	dirs []string,
 ) (*template.Template, []byte, bool, error) {
 	vardump := func(
 		facts *karma.Context,
@@ -96,12 +159,26 @@ func ProcessIncludes(
 			groups := reIncludeDirective.FindSubmatch(spec)
 
 			var (
-				path, config = string(groups[1]), groups[2]
-				data         = map[string]interface{}{}
+				path, options = string(groups[1]), string(groups[2])
+				config        = groups[3]
+				data          = map[string]interface{}{}
 
 				facts = karma.Describe("path", path)
 			)
 
+			if strings.TrimSpace(options) != "" || reLineRange.MatchString(path) {
+				var code []byte
+
+				code, err = IncludeCode(path, strings.Fields(options), dirs)
+				if err != nil {
+					err = facts.Format(err, "unable to include code")
+
+					return nil
+				}
+
+				return code
+			}
+
 			err = yaml.Unmarshal(config, &data)
 			if err != nil {
 				err = facts.
@@ -114,9 +191,11 @@ func ProcessIncludes(
 				return nil
 			}
 
+			SetVars(data, vars)
+
 			log.Tracef(vardump(facts, data), "including template %q", path)
 
-			templates, err = LoadTemplate(path, templates)
+			templates, err = LoadTemplate(path, templates, dirs...)
 			if err != nil {
 				err = facts.Format(err, "unable to load template")
 
@@ -143,3 +222,74 @@ func ProcessIncludes(
 
 	return templates, contents, recurse, err
 }
+
+// IncludeCode returns contents of specified source file wrapped into fenced
+// code block. Path can be suffixed with line range like file.go:10-25 to
+// include only specified lines. File is looked up in given directories as
+// well, like templates, see LoadTemplate. Supported options:
+//   - lang=<language>: language of code block.
+func IncludeCode(
+	path string,
+	options []string,
+	dirs []string,
+) ([]byte, error) {
+	var (
+		lang  string
+		first int
+		last  int
+	)
+
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || parts[0] != "lang" {
+			return nil, fmt.Errorf("unknown include option: %q", option)
+		}
+
+		lang = parts[1]
+	}
+
+	if matches := reLineRange.FindStringSubmatch(path); matches != nil {
+		path = matches[1]
+
+		// both are sequences of digits, so it's not possible to get an error
+		// except of overflow, which is caught by the range check below
+		first, _ = strconv.Atoi(matches[2])
+		last, _ = strconv.Atoi(matches[3])
+	}
+
+	path = findTemplate(path, dirs)
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, karma.Format(err, "unable to read file %q", path)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+
+	if first != 0 || last != 0 {
+		if first < 1 || last < first || last > len(lines) {
+			return nil, fmt.Errorf(
+				"line range %d-%d is out of bounds, file %q has %d lines",
+				first,
+				last,
+				path,
+				len(lines),
+			)
+		}
+
+		lines = lines[first-1 : last]
+	}
+
+	return fenceCode(strings.Join(lines, "\n"), lang), nil
+}
+
+// fenceCode wraps code into fenced code block of given language.
+func fenceCode(code string, lang string) []byte {
+	// fence should be longer than any backtick sequence inside code
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+
+	return []byte(fence + lang + "\n" + code + "\n" + fence)
+}
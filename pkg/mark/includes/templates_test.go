@@ -0,0 +1,151 @@
+package includes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncludeCode(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark-include-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "foo.go")
+
+	err = ioutil.WriteFile(path, []byte("a\nb\nc\nd\n"), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	code, err := IncludeCode(path+":2-3", []string{"lang=go"}, nil)
+	test.NoError(err)
+	test.Equal("```go\nb\nc\n```", string(code))
+
+	code, err = IncludeCode(path, nil, nil)
+	test.NoError(err)
+	test.Equal("```\na\nb\nc\nd\n```", string(code))
+
+	_, err = IncludeCode(path+":3-5", nil, nil)
+	test.Error(err)
+
+	_, err = IncludeCode(path, []string{"theme=dark"}, nil)
+	test.Error(err)
+
+	code, err = IncludeCode("foo.go:1-1", nil, []string{dir})
+	test.NoError(err)
+	test.Equal("```\na\n```", string(code))
+}
+
+func TestLoadTemplate_Dirs(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark-include-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "snippet.md"),
+		[]byte("shared {{ .Name }}"),
+		0644,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	templates, err := LoadTemplate(
+		"snippet.md",
+		template.New("root"),
+		"does-not-exist",
+		dir,
+	)
+	test.NoError(err)
+
+	var buffer bytes.Buffer
+
+	test.NoError(templates.Execute(&buffer, map[string]string{"Name": "x"}))
+	test.Equal("shared x", buffer.String())
+
+	_, err = LoadTemplate("missing.md", template.New("root"), dir)
+	test.Error(err)
+}
+
+func TestProcessEmbeds(t *testing.T) {
+	test := assert.New(t)
+
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			requests++
+
+			if request.URL.Path != "/raw/main.go" {
+				http.NotFound(writer, request)
+
+				return
+			}
+
+			fmt.Fprint(writer, "package main\n\nfunc main() {}\n")
+		},
+	))
+	defer server.Close()
+
+	markdown, err := ProcessEmbeds([]byte(
+		"Example:\n\n<!-- Embed: " + server.URL + "/raw/main.go lang=go -->\n\n" +
+			"<!-- Embed: " + server.URL + "/raw/main.go -->\n",
+	))
+	test.NoError(err)
+	test.Equal(
+		"Example:\n\n```go\npackage main\n\nfunc main() {}\n```\n\n"+
+			"```\npackage main\n\nfunc main() {}\n```\n",
+		string(markdown),
+	)
+	test.Equal(1, requests)
+
+	_, err = ProcessEmbeds([]byte("<!-- Embed: " + server.URL + "/missing.go -->"))
+	test.Error(err)
+
+	_, err = ProcessEmbeds([]byte("<!-- Embed: " + server.URL + "/raw/main.go theme=x -->"))
+	test.Error(err)
+
+	_, err = ProcessEmbeds([]byte("<!-- Embed: file:///etc/passwd -->"))
+	test.Error(err)
+}
+
+func TestLoadData(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark-data-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.yaml")
+
+	err = ioutil.WriteFile(path, []byte("week: 42\nteam: core\n"), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	data, err := LoadData(path)
+	test.NoError(err)
+	test.Equal(map[string]interface{}{"week": 42, "team": "core"}, data)
+
+	_, err = LoadData(filepath.Join(dir, "missing.yaml"))
+	test.Error(err)
+}
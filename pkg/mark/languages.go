@@ -0,0 +1,139 @@
+package mark
+
+import (
+	"strings"
+
+	"github.com/reconquest/pkg/log"
+)
+
+// CodeLanguages are languages supported by Confluence code macro.
+var CodeLanguages = map[string]bool{
+	"actionscript3": true,
+	"applescript":   true,
+	"bash":          true,
+	"c#":            true,
+	"coldfusion":    true,
+	"cpp":           true,
+	"css":           true,
+	"delphi":        true,
+	"diff":          true,
+	"erl":           true,
+	"groovy":        true,
+	"java":          true,
+	"jfx":           true,
+	"js":            true,
+	"perl":          true,
+	"php":           true,
+	"powershell":    true,
+	"py":            true,
+	"ruby":          true,
+	"sass":          true,
+	"scala":         true,
+	"sql":           true,
+	"text":          true,
+	"vb":            true,
+	"xml":           true,
+	"yml":           true,
+}
+
+// CodeThemes are themes supported by Confluence code macro.
+var CodeThemes = []string{
+	"Confluence",
+	"DJango",
+	"Eclipse",
+	"Emacs",
+	"FadeToGrey",
+	"Midnight",
+	"RDark",
+}
+
+// DefaultLanguageAliases maps common names of languages used in fenced code
+// blocks to languages supported by Confluence code macro.
+var DefaultLanguageAliases = map[string]string{
+	"as3":          "actionscript3",
+	"actionscript": "actionscript3",
+	"sh":           "bash",
+	"shell":        "bash",
+	"zsh":          "bash",
+	"console":      "bash",
+	"csharp":       "c#",
+	"cs":           "c#",
+	"c":            "cpp",
+	"c++":          "cpp",
+	"h":            "cpp",
+	"hpp":          "cpp",
+	"cfm":          "coldfusion",
+	"pascal":       "delphi",
+	"patch":        "diff",
+	"erlang":       "erl",
+	"javafx":       "jfx",
+	"javascript":   "js",
+	"jsx":          "js",
+	"json":         "js",
+	"node":         "js",
+	"pl":           "perl",
+	"ps1":          "powershell",
+	"posh":         "powershell",
+	"python":       "py",
+	"python3":      "py",
+	"rb":           "ruby",
+	"scss":         "sass",
+	"vbnet":        "vb",
+	"html":         "xml",
+	"xhtml":        "xml",
+	"svg":          "xml",
+	"yaml":         "yml",
+	"plain":        "text",
+	"plaintext":    "text",
+	"txt":          "text",
+}
+
+// CodeLanguage returns language supported by Confluence code macro for
+// language of fenced code block. Aliases take precedence over
+// DefaultLanguageAliases, unknown languages are rendered as text.
+func CodeLanguage(lang string, aliases map[string]string) string {
+	if lang == "" {
+		return ""
+	}
+
+	name := strings.ToLower(lang)
+
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+
+	if alias, ok := DefaultLanguageAliases[name]; ok {
+		return alias
+	}
+
+	if CodeLanguages[name] {
+		return name
+	}
+
+	return "text"
+}
+
+// CodeTheme returns theme supported by Confluence code macro with given name,
+// which is matched case-insensitively. Unknown themes are reported and
+// default theme is used instead.
+func CodeTheme(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	for _, theme := range CodeThemes {
+		if strings.EqualFold(theme, name) {
+			return theme
+		}
+	}
+
+	log.Warningf(
+		nil,
+		"unknown code block theme %q, using default theme; "+
+			"supported themes: %s",
+		name,
+		strings.Join(CodeThemes, ", "),
+	)
+
+	return ""
+}
@@ -0,0 +1,30 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeLanguage(t *testing.T) {
+	test := assert.New(t)
+
+	aliases := map[string]string{"go": "go", "sh": "powershell"}
+
+	test.Equal("", CodeLanguage("", aliases))
+	test.Equal("bash", CodeLanguage("bash", aliases))
+	test.Equal("py", CodeLanguage("Python", aliases))
+	test.Equal("go", CodeLanguage("go", aliases))
+	test.Equal("powershell", CodeLanguage("sh", aliases))
+	test.Equal("bash", CodeLanguage("sh", nil))
+	test.Equal("text", CodeLanguage("brainfuck", nil))
+}
+
+func TestCodeTheme(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("", CodeTheme(""))
+	test.Equal("Midnight", CodeTheme("Midnight"))
+	test.Equal("FadeToGrey", CodeTheme("fadetogrey"))
+	test.Equal("", CodeTheme("Solarized"))
+}
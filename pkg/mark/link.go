@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/kovetskiy/mark/pkg/confluence"
 	"github.com/reconquest/karma-go"
@@ -17,24 +19,45 @@ import (
 type LinkSubstitution struct {
 	From string
 	To   string
+
+	// Set for links to sections of other pages, which are substituted with
+	// links to anchors on these pages.
+	Space  string
+	Title  string
+	Anchor string
 }
 
+// reLinkScheme matches links with scheme like https:, mailto:, tel: or ftp:,
+// which are not relative links and are left as is. Scheme is at least two
+// characters long, so Windows drive letters are not mistaken for schemes.
+var reLinkScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]+:`)
+
 type markdownLink struct {
 	full     string
 	filename string
 	hash     string
 }
 
+// ResolveRelativeLinks resolves links to other markdown files into links to
+// their pages. Titles of files without Title header are derived from file
+// names using titleTransforms, unless they are nil, see TitleFromFilename.
 func ResolveRelativeLinks(
 	api *confluence.API,
 	meta *Meta,
 	markdown []byte,
 	base string,
+	titleTransforms []string,
 ) ([]LinkSubstitution, error) {
 	matches := parseLinks(string(markdown))
 
 	links := []LinkSubstitution{}
 	for _, match := range matches {
+		if reLinkScheme.MatchString(match.full) {
+			log.Tracef(nil, "skipping link with scheme: %s", match.full)
+
+			continue
+		}
+
 		log.Tracef(
 			nil,
 			"found a relative link: full=%s filename=%s hash=%s",
@@ -43,19 +66,18 @@ func ResolveRelativeLinks(
 			match.hash,
 		)
 
-		resolved, err := resolveLink(api, base, match)
+		link, err := resolveLink(api, meta, base, match, titleTransforms)
 		if err != nil {
 			return nil, karma.Format(err, "resolve link: %q", match.full)
 		}
 
-		if resolved == "" {
+		if link.To == "" {
 			continue
 		}
 
-		links = append(links, LinkSubstitution{
-			From: match.full,
-			To:   resolved,
-		})
+		link.From = match.full
+
+		links = append(links, link)
 	}
 
 	return links, nil
@@ -63,25 +85,27 @@ func ResolveRelativeLinks(
 
 func resolveLink(
 	api *confluence.API,
+	meta *Meta,
 	base string,
 	link markdownLink,
-) (string, error) {
-	var result string
+	titleTransforms []string,
+) (LinkSubstitution, error) {
+	var result LinkSubstitution
 
 	if len(link.filename) > 0 {
 		filepath := filepath.Join(base, link.filename)
 		if _, err := os.Stat(filepath); err != nil {
-			return "", nil
+			return result, nil
 		}
 
 		linkContents, err := ioutil.ReadFile(filepath)
 		if err != nil {
-			return "", karma.Format(err, "read file: %s", filepath)
+			return result, karma.Format(err, "read file: %s", filepath)
 		}
 
 		// This helps to determine if found link points to file that's
 		// not markdown or have mark required metadata
-		linkMeta, _, err := ExtractMeta(linkContents)
+		linkMeta, linkMarkdown, err := ExtractMeta(linkContents)
 		if err != nil {
 			log.Errorf(
 				err,
@@ -89,16 +113,47 @@ func resolveLink(
 				filepath,
 			)
 
-			return "", nil
+			return result, nil
+		}
+
+		// markdown files without headers are pages as well, if their titles
+		// are derived from file names
+		if linkMeta == nil && titleTransforms != nil &&
+			isMarkdownFile(filepath) {
+			linkMeta = &Meta{Type: TypePage}
 		}
 
 		if linkMeta == nil {
-			return "", nil
+			return result, nil
+		}
+
+		if linkMeta.Title == "" && titleTransforms != nil {
+			linkMeta.Title, err = TitleFromFilename(filepath, titleTransforms)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		if linkMeta.Title == "" {
+			log.Debugf(
+				nil,
+				"%q has no %s header; ignoring the relative link",
+				filepath,
+				HeaderTitle,
+			)
+
+			return result, nil
 		}
 
-		result, err = getConfluenceLink(api, linkMeta.Space, linkMeta.Title)
+		// linked page without explicit space lives in the same space as
+		// current page
+		if linkMeta.Space == "" && meta != nil {
+			linkMeta.Space = meta.Space
+		}
+
+		result.To, err = getConfluenceLink(api, linkMeta.Space, linkMeta.Title)
 		if err != nil {
-			return "", karma.Format(
+			return result, karma.Format(
 				err,
 				"find confluence page: %s / %s / %s",
 				filepath,
@@ -107,24 +162,179 @@ func resolveLink(
 			)
 		}
 
-		if result == "" {
-			return "", nil
+		if result.To == "" {
+			return result, nil
+		}
+
+		if len(link.hash) > 0 {
+			result.Space = linkMeta.Space
+			result.Title = linkMeta.Title
+			result.Anchor = resolveAnchor(linkMarkdown, link.hash)
+
+			if result.Anchor == "" {
+				log.Warningf(
+					nil,
+					"%q has no heading matching #%s, link will point "+
+						"to the page itself",
+					filepath,
+					link.hash,
+				)
+
+				result.Anchor = link.hash
+			}
 		}
 	}
 
 	if len(link.hash) > 0 {
-		result = result + "#" + link.hash
+		result.To = result.To + "#" + link.hash
 	}
 
 	return result, nil
 }
 
+func isMarkdownFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	}
+
+	return false
+}
+
+// resolveAnchor returns name of anchor which is added before heading of given
+// markdown matching specified hash, see CompileOptions.HeadingAnchors.
+func resolveAnchor(markdown []byte, hash string) string {
+	slug := Slugify(hash)
+
+	for _, anchor := range headingAnchors(markdown) {
+		if anchor == slug {
+			return anchor
+		}
+	}
+
+	return ""
+}
+
+// headingAnchors returns anchor names for every heading of given markdown in
+// the same way as they are named while compiling markdown.
+func headingAnchors(markdown []byte) []string {
+	anchors := []string{}
+
+	for _, heading := range parseHeadings(markdown) {
+		anchors = append(anchors, heading.Anchor)
+	}
+
+	return anchors
+}
+
+type heading struct {
+	Text   string
+	Slug   string
+	Anchor string
+}
+
+// parseHeadings returns headings of given markdown along with their anchor
+// names. Headings with the same slug are disambiguated by numeric suffix:
+// slug, slug-1, slug-2, ...
+func parseHeadings(markdown []byte) []heading {
+	code := codeRanges(markdown)
+
+	headings := []heading{}
+	names := map[string]bool{}
+
+	for _, match := range reHeading.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		text := string(markdown[match[2]:match[3]])
+
+		slug := Slugify(text)
+		if slug == "" {
+			slug = "section"
+		}
+
+		name := slug
+		for i := 1; names[name]; i++ {
+			name = fmt.Sprintf("%s-%d", slug, i)
+		}
+
+		names[name] = true
+
+		headings = append(headings, heading{
+			Text:   text,
+			Slug:   slug,
+			Anchor: name,
+		})
+	}
+
+	return headings
+}
+
+// warnDuplicateHeadings reports headings, slug of which is already used as
+// anchor of one of previous headings, so links to them by slug are
+// ambiguous.
+func warnDuplicateHeadings(markdown []byte) {
+	anchors := map[string]int{}
+
+	headings := parseHeadings(markdown)
+	for index, heading := range headings {
+		anchors[heading.Anchor] = index
+
+		if heading.Anchor == heading.Slug {
+			continue
+		}
+
+		previous := anchors[heading.Slug]
+
+		log.Warningf(
+			nil,
+			"heading %q (heading %d) has the same anchor %q as heading %q "+
+				"(heading %d), it is linked as #%s",
+			heading.Text,
+			index+1,
+			heading.Slug,
+			headings[previous].Text,
+			previous+1,
+			heading.Anchor,
+		)
+	}
+}
+
+var reHeading = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+?)[ \t#]*$`)
+
 func SubstituteLinks(markdown []byte, links []LinkSubstitution) []byte {
 	for _, link := range links {
 		if link.From == link.To {
 			continue
 		}
 
+		if link.Anchor != "" {
+			log.Tracef(
+				nil,
+				"substitute link: %q -> %s / %s #%s",
+				link.From,
+				link.Space,
+				link.Title,
+				link.Anchor,
+			)
+
+			pattern := regexp.MustCompile(
+				`\[([^\]]+)\]\(` + regexp.QuoteMeta(link.From) + `\)`,
+			)
+
+			markdown = pattern.ReplaceAll(markdown, []byte(fmt.Sprintf(
+				`<ac:link ac:anchor="%s">`+
+					`<ri:page ri:space-key="%s" ri:content-title="%s" />`+
+					`<ac:link-body>$1</ac:link-body></ac:link>`,
+				escapeReplacement(escapeAttribute(link.Anchor)),
+				escapeReplacement(escapeAttribute(link.Space)),
+				escapeReplacement(escapeAttribute(link.Title)),
+			)))
+
+			continue
+		}
+
 		log.Tracef(nil, "substitute link: %q -> %q", link.From, link.To)
 
 		markdown = bytes.ReplaceAll(
@@ -137,6 +347,95 @@ func SubstituteLinks(markdown []byte, links []LinkSubstitution) []byte {
 	return markdown
 }
 
+var rePageIDLink = regexp.MustCompile(`\[([^\]]*)\]\(confluence://(\d+)\)`)
+
+var pageTitles = struct {
+	sync.Mutex
+	pages map[string]*confluence.PageInfo
+}{pages: map[string]*confluence.PageInfo{}}
+
+// ResolvePageIDLinks replaces links to Confluence pages specified by page ID
+// like [](confluence://12345) with links to these pages. Links without text
+// get current title of the page as text, or page ID if page can't be
+// retrieved. Pages are retrieved only once per run.
+func ResolvePageIDLinks(api *confluence.API, markdown []byte) []byte {
+	return substitutePageIDLinks(
+		markdown,
+		api.BaseURL,
+		func(id string) *confluence.PageInfo {
+			pageTitles.Lock()
+			defer pageTitles.Unlock()
+
+			if page, ok := pageTitles.pages[id]; ok {
+				return page
+			}
+
+			page, err := api.GetPageByID(id)
+			if err != nil {
+				log.Warningf(err, "unable to retrieve page by id %s", id)
+			}
+
+			pageTitles.pages[id] = page
+
+			return page
+		},
+	)
+}
+
+func substitutePageIDLinks(
+	markdown []byte,
+	baseURL string,
+	lookup func(string) *confluence.PageInfo,
+) []byte {
+	code := codeRanges(markdown)
+
+	var buffer bytes.Buffer
+
+	last := 0
+	for _, match := range rePageIDLink.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		text := string(markdown[match[2]:match[3]])
+		id := string(markdown[match[4]:match[5]])
+
+		link := baseURL + "/pages/viewpage.action?pageId=" + id
+
+		page := lookup(id)
+		if page != nil {
+			link = baseURL + page.Links.Full
+		}
+
+		if text == "" {
+			text = id
+
+			if page != nil {
+				text = escapeLinkText(page.Title)
+			}
+		}
+
+		buffer.Write(markdown[last:match[0]])
+		fmt.Fprintf(&buffer, "[%s](%s)", text, link)
+
+		last = match[1]
+	}
+
+	buffer.Write(markdown[last:])
+
+	return buffer.Bytes()
+}
+
+var reLinkTextSpecial = regexp.MustCompile("([\\\\`*_\\[\\]<])")
+
+func escapeLinkText(text string) string {
+	return reLinkTextSpecial.ReplaceAllString(text, `\$1`)
+}
+
+func escapeReplacement(value string) string {
+	return strings.ReplaceAll(value, "$", "$$")
+}
+
 func parseLinks(markdown string) []markdownLink {
 	re := regexp.MustCompile("\\[[^\\]]+\\]\\((([^\\)#]+)?#?([^\\)]+)?)\\)")
 	matches := re.FindAllStringSubmatch(markdown, -1)
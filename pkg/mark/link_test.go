@@ -1,8 +1,15 @@
 package mark
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/kovetskiy/mark/pkg/confluence"
+	"github.com/kovetskiy/mark/pkg/mark/stdlib"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,3 +56,194 @@ func TestParseLinks(t *testing.T) {
 
 	assert.Equal(t, len(links), 7)
 }
+
+func TestResolveAnchor(t *testing.T) {
+	test := assert.New(t)
+
+	markdown := []byte(
+		"# Install\n\n## Prerequisites ##\n\n" +
+			"```\n# Not a heading\n```\n\n## Prerequisites\n",
+	)
+
+	test.Equal(
+		[]string{"install", "prerequisites", "prerequisites-1"},
+		headingAnchors(markdown),
+	)
+
+	test.Equal("prerequisites", resolveAnchor(markdown, "Prerequisites"))
+	test.Equal("prerequisites-1", resolveAnchor(markdown, "prerequisites-1"))
+	test.Equal("", resolveAnchor(markdown, "not-a-heading"))
+}
+
+func TestParseHeadings(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		[]heading{
+			{Text: "Setup", Slug: "setup", Anchor: "setup"},
+			{Text: "Setup!", Slug: "setup", Anchor: "setup-1"},
+			{Text: "Setup 1", Slug: "setup-1", Anchor: "setup-1-1"},
+			{Text: "???", Slug: "section", Anchor: "section"},
+		},
+		parseHeadings([]byte("# Setup\n\n## Setup!\n\n## Setup 1\n\n## ???\n")),
+	)
+}
+
+func TestSubstituteLinks_Anchor(t *testing.T) {
+	markdown := SubstituteLinks(
+		[]byte("[see setup](./install.md#prerequisites)"),
+		[]LinkSubstitution{{
+			From:   "./install.md#prerequisites",
+			To:     "http://confluence/display/TEST/Install#prerequisites",
+			Space:  "TEST",
+			Title:  "Install",
+			Anchor: "prerequisites",
+		}},
+	)
+
+	assert.Equal(
+		t,
+		`<ac:link ac:anchor="prerequisites">`+
+			`<ri:page ri:space-key="TEST" ri:content-title="Install" />`+
+			`<ac:link-body>see setup</ac:link-body></ac:link>`,
+		string(markdown),
+	)
+}
+
+func TestSubstitutePageIDLinks(t *testing.T) {
+	lookups := 0
+
+	lookup := func(id string) *confluence.PageInfo {
+		lookups++
+
+		if id != "123" {
+			return nil
+		}
+
+		page := &confluence.PageInfo{ID: id, Title: "Release [2.0]"}
+		page.Links.Full = "/display/TEST/Release"
+
+		return page
+	}
+
+	markdown := substitutePageIDLinks(
+		[]byte(
+			"[](confluence://123) [notes](confluence://123) "+
+				"[](confluence://456) `[](confluence://123)`",
+		),
+		"http://confluence",
+		lookup,
+	)
+
+	assert.Equal(
+		t,
+		`[Release \[2.0\]](http://confluence/display/TEST/Release) `+
+			`[notes](http://confluence/display/TEST/Release) `+
+			`[456](http://confluence/pages/viewpage.action?pageId=456) `+
+			"`[](confluence://123)`",
+		string(markdown),
+	)
+	assert.Equal(t, 3, lookups)
+}
+
+func TestResolveRelativeLinks_Schemes(t *testing.T) {
+	test := assert.New(t)
+
+	links, err := ResolveRelativeLinks(
+		nil,
+		nil,
+		[]byte(text(
+			"[email](mailto:foo@bar.com)",
+			"[phone](tel:+1-555-0100)",
+			"[file](ftp://example.com/file.txt#top)",
+			"[page](https://example.com/page#section)",
+		)),
+		".",
+		nil,
+	)
+	test.NoError(err)
+	test.Empty(links)
+
+	lib, err := stdlib.New(nil)
+	test.NoError(err)
+
+	test.Equal(
+		text(
+			`<p><a href="mailto:foo@bar.com">email</a> `+
+				`<a href="tel:+1-555-0100">phone</a></p>`,
+			"",
+		),
+		CompileMarkdown(
+			[]byte("[email](mailto:foo@bar.com) [phone](tel:+1-555-0100)\n"),
+			lib,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestResolveRelativeLinks_TitleFromFilename(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark-links")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"getting-started.md": "# Getting started\n",
+		"release_notes.md":   "<!-- Space: OPS -->\n\n# Notes\n",
+		"diagram.png":        "png",
+	} {
+		path := filepath.Join(dir, name)
+		test.NoError(ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			query := request.URL.Query()
+
+			writer.Write([]byte(`{"results": [{` +
+				`"id": "1", "type": "page", ` +
+				`"title": "` + query.Get("title") + `", ` +
+				`"_links": {"webui": "/display/` + query.Get("spaceKey") +
+				`/` + query.Get("title") + `"}` +
+				`}]}`))
+		},
+	))
+	defer server.Close()
+
+	api := confluence.NewAPI(server.URL, "", "", nil, confluence.Options{})
+
+	markdown := []byte(text(
+		"[start](getting-started.md)",
+		"[notes](release_notes.md#notes)",
+		"[diagram](diagram.png)",
+	))
+
+	links, err := ResolveRelativeLinks(
+		api,
+		&Meta{Space: "DOC"},
+		markdown,
+		dir,
+		[]string{"spaces", "title"},
+	)
+	test.NoError(err)
+	test.Len(links, 2)
+
+	test.Equal("getting-started.md", links[0].From)
+	test.Equal(server.URL+"/display/DOC/Getting Started", links[0].To)
+
+	test.Equal("release_notes.md#notes", links[1].From)
+	test.Equal("Release Notes", links[1].Title)
+	test.Equal("OPS", links[1].Space)
+
+	links, err = ResolveRelativeLinks(
+		api,
+		&Meta{Space: "DOC"},
+		markdown,
+		dir,
+		nil,
+	)
+	test.NoError(err)
+	test.Empty(links)
+}
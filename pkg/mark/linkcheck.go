@@ -0,0 +1,160 @@
+package mark
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var reExternalLink = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+
+type LinkCheckOptions struct {
+	// Concurrency limits number of simultaneous requests.
+	Concurrency int
+
+	// Timeout limits time of every request.
+	Timeout time.Duration
+
+	// SkipDomains lists domains (including subdomains) which are not checked.
+	SkipDomains []string
+}
+
+type BrokenLink struct {
+	URL    string
+	Reason string
+}
+
+// CheckExternalLinks requests every external link found in markdown outside
+// of code and returns links which didn't respond with 2xx status, sorted by
+// URL.
+func CheckExternalLinks(
+	markdown []byte,
+	options LinkCheckOptions,
+) []BrokenLink {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+
+	client := &http.Client{Timeout: options.Timeout}
+
+	var (
+		links  = make(chan string)
+		broken = []BrokenLink{}
+		mutex  sync.Mutex
+		group  sync.WaitGroup
+	)
+
+	for i := 0; i < options.Concurrency; i++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+
+			for link := range links {
+				reason := checkLink(client, link)
+				if reason == "" {
+					continue
+				}
+
+				mutex.Lock()
+				broken = append(broken, BrokenLink{URL: link, Reason: reason})
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, link := range extractExternalLinks(markdown) {
+		if !matchDomains(link, options.SkipDomains) {
+			links <- link
+		}
+	}
+
+	close(links)
+
+	group.Wait()
+
+	sort.Slice(broken, func(i, j int) bool {
+		return broken[i].URL < broken[j].URL
+	})
+
+	return broken
+}
+
+func extractExternalLinks(markdown []byte) []string {
+	var (
+		code  = codeRanges(markdown)
+		seen  = map[string]bool{}
+		links = []string{}
+	)
+
+	for _, match := range reExternalLink.FindAllIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		link := strings.TrimRight(string(markdown[match[0]:match[1]]), ".,;:!?*_")
+		if seen[link] {
+			continue
+		}
+
+		seen[link] = true
+
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// matchDomains reports whether link points to one of given domains or their
+// subdomains.
+func matchDomains(link string, domains []string) bool {
+	uri, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(uri.Hostname())
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkLink returns reason why the link is considered broken or empty string.
+// Some servers don't support HEAD requests, so GET is used as fallback.
+func checkLink(client *http.Client, link string) string {
+	var reason string
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		request, err := http.NewRequest(method, link, nil)
+		if err != nil {
+			return err.Error()
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			reason = err.Error()
+
+			continue
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode >= 200 && response.StatusCode < 300 {
+			return ""
+		}
+
+		reason = fmt.Sprintf("unexpected status: %s", response.Status)
+	}
+
+	return reason
+}
@@ -0,0 +1,68 @@
+package mark
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractExternalLinks(t *testing.T) {
+	links := extractExternalLinks([]byte(text(
+		"[a](https://example.com/a) and https://example.com/b.",
+		"<https://example.com/a>",
+		"`https://example.com/code`",
+		"```",
+		"https://example.com/fenced",
+		"```",
+	)))
+
+	assert.Equal(
+		t,
+		[]string{"https://example.com/a", "https://example.com/b"},
+		links,
+	)
+}
+
+func TestCheckExternalLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			switch request.URL.Path {
+			case "/ok":
+				writer.WriteHeader(http.StatusOK)
+			case "/get-only":
+				if request.Method != http.MethodGet {
+					writer.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			default:
+				writer.WriteHeader(http.StatusNotFound)
+			}
+		},
+	))
+	defer server.Close()
+
+	broken := CheckExternalLinks(
+		[]byte(text(
+			server.URL+"/ok",
+			server.URL+"/get-only",
+			server.URL+"/missing",
+			"https://skipped.example.com/missing",
+		)),
+		LinkCheckOptions{
+			Concurrency: 2,
+			SkipDomains: []string{"example.com"},
+		},
+	)
+
+	assert.Equal(
+		t,
+		[]BrokenLink{
+			{
+				URL:    server.URL + "/missing",
+				Reason: "unexpected status: 404 Not Found",
+			},
+		},
+		broken,
+	)
+}
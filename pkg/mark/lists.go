@@ -0,0 +1,97 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// Markdown renderer doesn't keep numbers of ordered list items, so ordered
+// lists interrupted by code blocks or paragraphs are always restarted from 1.
+// To preserve numbering, every ordered list item is prefixed with a marker
+// containing its number, which is used to render start attribute of the
+// list and removed afterwards.
+
+var (
+	reOrderedListItem = regexp.MustCompile(
+		`(?m)^([ \t]*(?:>[ \t]*)*\d{1,9}[.)][ \t]+)(\S)`,
+	)
+
+	reListItemMarker = regexp.MustCompile(`MARKLISTITEM(\d+)END `)
+)
+
+// items starting with these characters are not marked, because marker
+// would change the way their contents are parsed
+const listItemUnmarkable = "#>-+*|<`~"
+
+func markOrderedListItems(markdown []byte) []byte {
+	code := codeRanges(markdown)
+
+	var (
+		result []byte
+		last   int
+	)
+
+	for _, match := range reOrderedListItem.FindAllSubmatchIndex(markdown, -1) {
+		prefix := markdown[match[2]:match[3]]
+		first := markdown[match[4]:match[5]]
+
+		if insideRanges(code, match[0]) ||
+			bytes.ContainsAny(first, listItemUnmarkable) {
+			continue
+		}
+
+		number := bytes.TrimLeft(bytes.TrimSpace(prefix), "> \t")
+		number = number[:len(number)-1]
+
+		result = append(result, markdown[last:match[3]]...)
+		result = append(result, fmt.Sprintf("MARKLISTITEM%sEND ", number)...)
+
+		last = match[3]
+	}
+
+	return append(result, markdown[last:]...)
+}
+
+func unmarkOrderedListItems(html []byte) []byte {
+	return reListItemMarker.ReplaceAll(html, nil)
+}
+
+// renderOrderedList renders opening tag of ordered list with start attribute
+// if the first item of the list is not numbered as 1.
+func (renderer ConfluenceRenderer) renderOrderedList(
+	writer io.Writer,
+	node *bf.Node,
+) bool {
+	text := firstText(node)
+	if text == nil {
+		return false
+	}
+
+	matches := reListItemMarker.FindSubmatch(text.Literal)
+	if matches == nil || bytes.Index(text.Literal, matches[0]) != 0 {
+		return false
+	}
+
+	start, err := strconv.Atoi(string(matches[1]))
+	if err != nil || start == 1 {
+		return false
+	}
+
+	var buffer bytes.Buffer
+
+	renderer.Renderer.RenderNode(&buffer, node, true)
+
+	writer.Write(bytes.Replace(
+		buffer.Bytes(),
+		[]byte("<ol>"),
+		[]byte(fmt.Sprintf(`<ol start="%d">`, start)),
+		1,
+	))
+
+	return true
+}
@@ -0,0 +1,126 @@
+package macro
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+
+	"github.com/kovetskiy/mark/pkg/mark/includes"
+	"github.com/reconquest/karma-go"
+	"github.com/reconquest/pkg/log"
+	"gopkg.in/yaml.v2"
+)
+
+var reBlockMacroDirective = regexp.MustCompile(
+	// <!-- Macro: <template path>
+	//      <optional yaml data> -->
+	// <body>
+	// <!-- EndMacro -->
+
+	`(?s)<!--\s*(?:` +
+		`Macro:\s*(?P<template>[^\s>]+)(?P<config>.*?)|` +
+		`EndMacro\s*` +
+		`)-->`,
+)
+
+type blockMacro struct {
+	template string
+	config   []byte
+	body     bytes.Buffer
+}
+
+// ApplyBlockMacros replaces block macros with specified templates executed
+// with data from yaml config and captured body available as .Body. Block
+// macros can be nested, inner macros are expanded first. Macro definitions
+// should be extracted by ExtractMacros before, because they use the same
+// Macro: directive.
+func ApplyBlockMacros(
+	contents []byte,
+	templates *template.Template,
+	vars map[string]interface{},
+) ([]byte, error) {
+	// the root block holds contents outside of any block macro
+	stack := []*blockMacro{{}}
+
+	matches := reBlockMacroDirective.FindAllSubmatchIndex(contents, -1)
+
+	last := 0
+	for _, match := range matches {
+		top := stack[len(stack)-1]
+		top.body.Write(contents[last:match[0]])
+
+		last = match[1]
+
+		if match[2] >= 0 {
+			stack = append(stack, &blockMacro{
+				template: string(contents[match[2]:match[3]]),
+				config:   contents[match[4]:match[5]],
+			})
+
+			continue
+		}
+
+		if len(stack) == 1 {
+			return nil, fmt.Errorf(
+				"unexpected EndMacro without opening Macro directive",
+			)
+		}
+
+		stack = stack[:len(stack)-1]
+
+		result, err := top.execute(templates, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		stack[len(stack)-1].body.Write(result)
+	}
+
+	if len(stack) > 1 {
+		return nil, fmt.Errorf(
+			"block macro %q is not closed by EndMacro directive",
+			stack[len(stack)-1].template,
+		)
+	}
+
+	stack[0].body.Write(contents[last:])
+
+	return stack[0].body.Bytes(), nil
+}
+
+func (block *blockMacro) execute(
+	templates *template.Template,
+	vars map[string]interface{},
+) ([]byte, error) {
+	facts := karma.Describe("template", block.template)
+
+	data := map[string]interface{}{}
+
+	err := yaml.Unmarshal(block.config, &data)
+	if err != nil {
+		return nil, facts.
+			Describe("config", string(block.config)).
+			Format(err, "unable to unmarshal block macro config")
+	}
+
+	data["Body"] = string(bytes.Trim(block.body.Bytes(), "\n"))
+
+	includes.SetVars(data, vars)
+
+	template, err := includes.LoadTemplate(block.template, templates)
+	if err != nil {
+		return nil, facts.Format(err, "unable to load template")
+	}
+
+	log.Tracef(facts, "applying block macro")
+
+	var buffer bytes.Buffer
+
+	err = template.Execute(&buffer, data)
+	if err != nil {
+		return nil, facts.Format(err, "unable to execute block macro template")
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,45 @@
+package macro
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyBlockMacros(t *testing.T) {
+	test := assert.New(t)
+
+	templates := template.Must(
+		template.New(`warning`).Parse(`[{{ .Title }}: {{ .Body }}]`),
+	)
+
+	contents, err := ApplyBlockMacros(
+		[]byte(
+			"before\n"+
+				"<!-- Macro: warning\n"+
+				"     Title: outer -->\n"+
+				"a\n"+
+				"<!-- Macro: warning\n"+
+				"     Title: inner -->\n"+
+				"b\n"+
+				"<!-- EndMacro -->\n"+
+				"<!-- EndMacro -->\n"+
+				"after",
+		),
+		templates,
+		nil,
+	)
+	test.NoError(err)
+	test.Equal("before\n[outer: a\n[inner: b]]\nafter", string(contents))
+
+	_, err = ApplyBlockMacros(
+		[]byte("<!-- Macro: warning -->\n"),
+		templates,
+		nil,
+	)
+	test.Error(err)
+
+	_, err = ApplyBlockMacros([]byte("<!-- EndMacro -->\n"), templates, nil)
+	test.Error(err)
+}
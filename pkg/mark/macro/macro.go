@@ -33,6 +33,7 @@ type Macro struct {
 
 func (macro *Macro) Apply(
 	content []byte,
+	vars map[string]interface{},
 ) ([]byte, error) {
 	var err error
 
@@ -49,6 +50,8 @@ func (macro *Macro) Apply(
 				)
 			}
 
+			includes.SetVars(config, vars)
+
 			var buffer bytes.Buffer
 
 			err = macro.Template.Execute(&buffer, macro.configure(
@@ -0,0 +1,111 @@
+package mark
+
+import (
+	"regexp"
+	"strings"
+)
+
+var reMacroTag = regexp.MustCompile(
+	`(?s)<!\[CDATA\[.*?\]\]>|` +
+		`<ac:structured-macro\b([^>]*?)(/?)>|` +
+		`</ac:structured-macro>`,
+)
+
+var reMacroName = regexp.MustCompile(`\bac:name="([^"]*)"`)
+
+// FilterMacros removes macros, which are not allowed on Confluence side,
+// along with their contents from compiled page, so page is uploaded without
+// them instead of being rejected. Macro is allowed if it's listed in allowed
+// (or allowed is empty) and isn't listed in denied, names are case
+// insensitive. Returns names of removed macros.
+func FilterMacros(
+	contents string,
+	allowed []string,
+	denied []string,
+) (string, []string) {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return contents, nil
+	}
+
+	isAllowed := func(name string) bool {
+		for _, item := range denied {
+			if strings.EqualFold(item, name) {
+				return false
+			}
+		}
+
+		if len(allowed) == 0 {
+			return true
+		}
+
+		for _, item := range allowed {
+			if strings.EqualFold(item, name) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var (
+		buffer  strings.Builder
+		removed = []string{}
+		last    = 0
+
+		// depth is a nesting level of macros inside the macro being removed,
+		// which is zero if no macro is being removed
+		depth = 0
+	)
+
+	for _, match := range reMacroTag.FindAllStringSubmatchIndex(contents, -1) {
+		tag := contents[match[0]:match[1]]
+
+		switch {
+		case strings.HasPrefix(tag, "<![CDATA["):
+			continue
+
+		case strings.HasPrefix(tag, "</"):
+			if depth > 0 {
+				depth--
+
+				if depth == 0 {
+					last = match[1]
+				}
+			}
+
+		case depth > 0:
+			if match[4] == match[5] {
+				depth++
+			}
+
+		default:
+			var name string
+			if groups := reMacroName.FindStringSubmatch(
+				contents[match[2]:match[3]],
+			); groups != nil {
+				name = groups[1]
+			}
+
+			if isAllowed(name) {
+				continue
+			}
+
+			removed = append(removed, name)
+
+			buffer.WriteString(contents[last:match[0]])
+
+			if match[4] == match[5] {
+				depth = 1
+			} else {
+				last = match[1]
+			}
+		}
+	}
+
+	// unbalanced macro is removed till the end of the page
+	if depth == 0 {
+		buffer.WriteString(contents[last:])
+	}
+
+	return buffer.String(), removed
+}
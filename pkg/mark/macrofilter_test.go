@@ -0,0 +1,46 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMacros(t *testing.T) {
+	test := assert.New(t)
+
+	contents := `<p>a</p>` +
+		`<ac:structured-macro ac:name="html">` +
+		`<ac:plain-text-body><![CDATA[</ac:structured-macro>]]></ac:plain-text-body>` +
+		`</ac:structured-macro>` +
+		`<ac:structured-macro ac:name="info"><ac:rich-text-body>` +
+		`<ac:structured-macro ac:name="iframe"><ac:parameter ac:name="src">x</ac:parameter>` +
+		`<ac:structured-macro ac:name="status" /></ac:structured-macro>` +
+		`<p>b</p></ac:rich-text-body></ac:structured-macro>` +
+		`<ac:structured-macro ac:name="anchor" />`
+
+	filtered, removed := FilterMacros(contents, nil, []string{"HTML", "iframe"})
+	test.Equal(
+		`<p>a</p>`+
+			`<ac:structured-macro ac:name="info"><ac:rich-text-body>`+
+			`<p>b</p></ac:rich-text-body></ac:structured-macro>`+
+			`<ac:structured-macro ac:name="anchor" />`,
+		filtered,
+	)
+	test.Equal([]string{"html", "iframe"}, removed)
+
+	filtered, removed = FilterMacros(contents, []string{"info", "iframe"}, nil)
+	test.Equal(
+		`<p>a</p>`+
+			`<ac:structured-macro ac:name="info"><ac:rich-text-body>`+
+			`<ac:structured-macro ac:name="iframe"><ac:parameter ac:name="src">x</ac:parameter>`+
+			`</ac:structured-macro>`+
+			`<p>b</p></ac:rich-text-body></ac:structured-macro>`,
+		filtered,
+	)
+	test.Equal([]string{"html", "status", "anchor"}, removed)
+
+	filtered, removed = FilterMacros(contents, nil, nil)
+	test.Equal(contents, filtered)
+	test.Empty(removed)
+}
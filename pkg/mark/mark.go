@@ -1,6 +1,7 @@
 package mark
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/kovetskiy/mark/pkg/confluence"
@@ -13,16 +14,75 @@ func ResolvePage(
 	api *confluence.API,
 	meta *Meta,
 ) (*confluence.PageInfo, *confluence.PageInfo, error) {
-	page, err := api.FindPage(meta.Space, meta.Title, meta.Type)
+	if meta.PageID != "" {
+		page, err := api.GetPageByID(meta.PageID)
+		if err != nil {
+			return nil, nil, karma.Format(
+				err,
+				"error while retrieving page by id %q",
+				meta.PageID,
+			)
+		}
+
+		log.Infof(
+			nil,
+			"page is pinned by %s header: %s",
+			HeaderPageID,
+			meta.PageID,
+		)
+
+		return nil, page, nil
+	}
+
+	if meta.Space == "" {
+		return nil, nil, fmt.Errorf(
+			"space key is not set (%s header is not set "+
+				"and no default space is configured)",
+			HeaderSpace,
+		)
+	}
+
+	if meta.Title == "" {
+		return nil, nil, fmt.Errorf(
+			"page title is not set (%s header is not set)",
+			HeaderTitle,
+		)
+	}
+
+	exists, err := api.SpaceExists(meta.Space)
 	if err != nil {
 		return nil, nil, karma.Format(
 			err,
-			"error while finding page %q",
-			meta.Title,
+			"error while checking space %q",
+			meta.Space,
 		)
 	}
 
-	if meta.Type == "blogpost" {
+	if !exists {
+		return nil, nil, fmt.Errorf(
+			"space %q is not found or you don't have access to it",
+			meta.Space,
+		)
+	}
+
+	if meta.Type == TypeBlogPost {
+		if len(meta.Parents) > 0 {
+			log.Warningf(
+				nil,
+				"blog posts can't have parents, %s headers are ignored",
+				HeaderParent,
+			)
+		}
+
+		page, err := api.FindBlogPost(meta.Space, meta.Title, meta.Date)
+		if err != nil {
+			return nil, nil, karma.Format(
+				err,
+				"error while finding blog post %q",
+				meta.Title,
+			)
+		}
+
 		log.Infof(
 			nil,
 			"blog post will be stored as: %s",
@@ -32,6 +92,37 @@ func ResolvePage(
 		return nil, page, nil
 	}
 
+	// draft pages are not found unless explicitly requested
+	var status string
+	if meta.Status == StatusDraft {
+		status = StatusCurrent + "," + StatusDraft
+	}
+
+	if meta.ParentID != "" {
+		return resolvePageByParentID(api, meta, status)
+	}
+
+	page, err := findPage(api, meta, status)
+	if err != nil {
+		return nil, nil, karma.Format(
+			err,
+			"error while finding page %q",
+			meta.Title,
+		)
+	}
+
+	// renamed page is found by its previous title, which is checked against
+	// parents and is changed afterwards
+	var renamed bool
+	if page == nil {
+		page, err = findRenamedPage(api, meta, status)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		renamed = page != nil
+	}
+
 	ancestry := meta.Parents
 	if page != nil {
 		ancestry = append(ancestry, page.Title)
@@ -93,5 +184,178 @@ func ResolvePage(
 		meta.Title,
 	)
 
+	if renamed {
+		RenamePage(page, meta.Title)
+	}
+
+	return parent, page, nil
+}
+
+// ResolvePageByID returns page specified by ID, like page specified by
+// command line URL. Page is renamed to given title unless title is empty, so
+// the new title is sent along with page contents by UpdatePage.
+func ResolvePageByID(
+	api *confluence.API,
+	pageID string,
+	title string,
+) (*confluence.PageInfo, error) {
+	page, err := api.GetPageByID(pageID)
+	if err != nil {
+		return nil, karma.Format(
+			err,
+			"error while retrieving page by id %q",
+			pageID,
+		)
+	}
+
+	RenamePage(page, title)
+
+	return page, nil
+}
+
+func resolvePageByParentID(
+	api *confluence.API,
+	meta *Meta,
+	status string,
+) (*confluence.PageInfo, *confluence.PageInfo, error) {
+	parent, err := api.GetPageByID(meta.ParentID)
+	if err != nil {
+		return nil, nil, karma.Format(
+			err,
+			"error while retrieving parent page by id %q",
+			meta.ParentID,
+		)
+	}
+
+	page, err := findPage(api, meta, status)
+	if err != nil {
+		return nil, nil, karma.Format(
+			err,
+			"error while finding page %q",
+			meta.Title,
+		)
+	}
+
+	if page == nil {
+		page, err = findRenamedPage(api, meta, status)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if page != nil {
+			RenamePage(page, meta.Title)
+		}
+	}
+
+	log.Infof(
+		nil,
+		"page will be stored under parent page %s (%s): %s",
+		parent.Title,
+		parent.ID,
+		meta.Title,
+	)
+
 	return parent, page, nil
 }
+
+// findRenamedPage finds page by previous titles listed in RenameFrom header,
+// so page of renamed file is renamed instead of creating new page. Redirect
+// pages left at previous titles are skipped.
+func findRenamedPage(
+	api *confluence.API,
+	meta *Meta,
+	status string,
+) (*confluence.PageInfo, error) {
+	for _, title := range meta.RenameFrom {
+		if title == meta.Title {
+			continue
+		}
+
+		page, err := api.FindPageWithStatus(
+			meta.Space,
+			title,
+			meta.Type,
+			status,
+		)
+		if err != nil {
+			return nil, karma.Format(
+				err,
+				"error while finding page %q",
+				title,
+			)
+		}
+
+		if page == nil {
+			continue
+		}
+
+		var target string
+
+		redirect, err := api.GetContentProperty(
+			page.ID,
+			RedirectProperty,
+			&target,
+		)
+		if err != nil {
+			return nil, karma.Format(
+				err,
+				"error while reading properties of page %q",
+				title,
+			)
+		}
+
+		if redirect {
+			continue
+		}
+
+		return page, nil
+	}
+
+	return nil, nil
+}
+
+// RenamePage changes title of given page, so the new title is sent along
+// with page contents by UpdatePage. Page is left as is if title is empty or
+// is the same.
+func RenamePage(page *confluence.PageInfo, title string) {
+	if title == "" || title == page.Title {
+		return
+	}
+
+	log.Infof(nil, "renaming page %q to %q", page.Title, title)
+
+	page.Title = title
+}
+
+// findPage finds page with given status. Archived pages are found as well,
+// so they can be restored, unless draft page is requested.
+func findPage(
+	api *confluence.API,
+	meta *Meta,
+	status string,
+) (*confluence.PageInfo, error) {
+	page, err := api.FindPageWithStatus(
+		meta.Space,
+		meta.Title,
+		meta.Type,
+		status,
+	)
+	if err != nil || page != nil || meta.Status == StatusDraft {
+		return page, err
+	}
+
+	// instances without archival support reject archived status
+	page, err = api.FindPageWithStatus(
+		meta.Space,
+		meta.Title,
+		meta.Type,
+		StatusArchived,
+	)
+	if err != nil {
+		log.Debugf(nil, "unable to find archived page %q: %s", meta.Title, err)
+
+		return nil, nil
+	}
+
+	return page, nil
+}
@@ -0,0 +1,130 @@
+package mark
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kovetskiy/mark/pkg/confluence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePageByID_Rename(t *testing.T) {
+	test := assert.New(t)
+
+	var updated struct {
+		Title   string `json:"title"`
+		Version struct {
+			Number int64 `json:"number"`
+		} `json:"version"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != "/rest/api/content/42" {
+				writer.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			switch request.Method {
+			case http.MethodGet:
+				writer.Write([]byte(`{
+					"id": "42",
+					"title": "Old",
+					"type": "page",
+					"version": {"number": 3},
+					"ancestors": [{"id": "1", "title": "Home"}]
+				}`))
+
+			case http.MethodPut:
+				err := json.NewDecoder(request.Body).Decode(&updated)
+				if err != nil {
+					writer.WriteHeader(http.StatusBadRequest)
+
+					return
+				}
+
+				writer.Write([]byte(`{}`))
+			}
+		},
+	))
+	defer server.Close()
+
+	api := confluence.NewAPI(server.URL, "", "", nil, confluence.Options{})
+
+	page, err := ResolvePageByID(api, "42", "New")
+	test.NoError(err)
+	test.Equal("New", page.Title)
+
+	test.NoError(api.UpdatePage(page, "<p>text</p>", false, nil, ""))
+	test.Equal("New", updated.Title)
+	test.Equal(int64(4), updated.Version.Number)
+
+	page, err = ResolvePageByID(api, "42", "")
+	test.NoError(err)
+	test.Equal("Old", page.Title)
+
+	_, err = ResolvePageByID(api, "43", "New")
+	test.Error(err)
+}
+
+func TestResolvePage_RenameFrom(t *testing.T) {
+	test := assert.New(t)
+
+	pages := map[string]string{
+		"Home":    `{"id": "1", "title": "Home", "type": "page"}`,
+		"Install": `{"id": "2", "title": "Install", "type": "page", "ancestors": [{"id": "1", "title": "Home"}]}`,
+		"Old":     `{"id": "3", "title": "Old", "type": "page", "ancestors": [{"id": "1", "title": "Home"}]}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			switch request.URL.Path {
+			case "/rest/api/space/DOC":
+				writer.Write([]byte(`{}`))
+
+			case "/rest/api/content/":
+				title := request.URL.Query().Get("title")
+				if title == "" {
+					title = "Home"
+				}
+
+				if page, ok := pages[title]; ok {
+					writer.Write([]byte(`{"results": [` + page + `]}`))
+				} else {
+					writer.Write([]byte(`{"results": []}`))
+				}
+
+			// page left at previous title is redirect to the renamed page
+			case "/rest/api/content/3/property/" + RedirectProperty:
+				writer.Write([]byte(`{"value": "2"}`))
+
+			default:
+				writer.WriteHeader(http.StatusNotFound)
+			}
+		},
+	))
+	defer server.Close()
+
+	api := confluence.NewAPI(server.URL, "", "", nil, confluence.Options{})
+
+	meta := &Meta{
+		Space:      "DOC",
+		Type:       TypePage,
+		Title:      "Setup",
+		RenameFrom: []string{"Old", "Install"},
+	}
+
+	_, page, err := ResolvePage(true, api, meta)
+	test.NoError(err)
+	test.Equal("2", page.ID)
+	test.Equal("Setup", page.Title)
+
+	meta.RenameFrom = []string{"Old", "Missing"}
+
+	_, page, err = ResolvePage(true, api, meta)
+	test.NoError(err)
+	test.Nil(page)
+}
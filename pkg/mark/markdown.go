@@ -1,9 +1,11 @@
 package mark
 
 import (
+	"fmt"
 	"io"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/kovetskiy/mark/pkg/mark/stdlib"
 	"github.com/reconquest/pkg/log"
@@ -14,10 +16,104 @@ type ConfluenceRenderer struct {
 	bf.Renderer
 
 	Stdlib *stdlib.Lib
+
+	HeadingAnchors bool
+	Mentions       bool
+	HTMLMacro      bool
+	ImageCaptions  bool
+	EmbedMacros    bool
+	SubSuperscript bool
+
+	SmartLinkDomains []string
+	NewWindowDomains []string
+	InternalDomains  []string
+	LanguageAliases  map[string]string
+	WideTableColumns int
+	HeadingNumbers   int
+
+	anchors      map[string]bool
+	numbers      []int
+	tasks        map[*bf.Node]task
+	attributions map[*bf.Node]bool
+	admonitions  map[*bf.Node]admonition
 }
 
+// CompileOptions controls optional transformations applied by
+// CompileMarkdown.
+type CompileOptions struct {
+	// HeadingAnchors makes every heading preceded by the anchor macro named
+	// after the heading slug, and in-page links like [text](#slug) point to
+	// that anchor.
+	HeadingAnchors bool
+
+	// Mentions makes @username references rendered as user mentions.
+	Mentions bool
+
+	// HTMLMacro allows ```html-macro code blocks to be inserted as raw HTML
+	// using HTML macro, which should be enabled on Confluence side.
+	HTMLMacro bool
+
+	// StrictEntities disables unescaping of entities which were escaped
+	// twice, see NormalizeEntities.
+	StrictEntities bool
+
+	// ImageCaptions makes image alt text displayed as caption below the
+	// image.
+	ImageCaptions bool
+
+	// SmartLinkDomains lists domains, bare links to which (and to their
+	// subdomains) are rendered as smart links, displayed by Confluence as
+	// inline cards.
+	SmartLinkDomains []string
+
+	// NewWindowDomains lists domains, external links to which (and to their
+	// subdomains) open in new window, "*" matches every domain.
+	NewWindowDomains []string
+
+	// InternalDomains lists domains of Confluence, links to which are
+	// internal and always open in the same window.
+	InternalDomains []string
+
+	// KeepComments keeps HTML comments in compiled page, which are removed
+	// by default.
+	KeepComments bool
+
+	// EmbedMacros allows ```iframe and ```widget code blocks to be rendered
+	// as iframe and widget connector macros, which may be restricted on
+	// Confluence side.
+	EmbedMacros bool
+
+	// WideTableColumns makes tables with at least that many columns wrapped
+	// into horizontally scrollable container, zero disables wrapping.
+	WideTableColumns int
+
+	// SubSuperscript makes Pandoc-style subscript like H~2~O and superscript
+	// like x^2^ rendered as <sub> and <sup> elements.
+	SubSuperscript bool
+
+	// LanguageAliases maps languages of fenced code blocks to languages
+	// supported by Confluence code macro, see CodeLanguage.
+	LanguageAliases map[string]string
+
+	// AllowedMacros lists macros, which are allowed on Confluence side, other
+	// macros are removed from compiled page, see FilterMacros.
+	AllowedMacros []string
+
+	// DeniedMacros lists macros, which are rejected by Confluence and removed
+	// from compiled page.
+	DeniedMacros []string
+
+	// HeadingNumbers makes headings of that level and below prefixed with
+	// hierarchical number like 1.2.3, e.g. 2 leaves H1 as is and numbers H2
+	// as 1, 2, ..., zero disables numbering.
+	HeadingNumbers int
+}
+
+var reCodeParameter = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|(\S*))`)
+
 func ParseLanguage(lang string) string {
-	// lang takes the following form: language? "collapse"? ("title"? <any string>*)?
+	// lang takes the following form:
+	// language? (<key>=<value>)* "collapse"? ("title"? <any string>*)?
 	// let's split it by spaces
 	paramlist := strings.Fields(lang)
 
@@ -27,8 +123,8 @@ func ParseLanguage(lang string) string {
 		first = paramlist[0]
 	}
 
-	if first == "collapse" || first == "title" {
-		// collapsing or including a title without a language
+	if first == "collapse" || first == "title" || strings.Contains(first, "=") {
+		// collapsing, including a title or parameters without a language
 		return ""
 	}
 	// the default case with language being the first one
@@ -47,14 +143,255 @@ func ParseTitle(lang string) string {
 	return ""
 }
 
+// ParseCodeParameters returns parameters specified in code block info string
+// in form of key=value or key="value with spaces".
+func ParseCodeParameters(lang string) map[string]string {
+	params := map[string]string{}
+
+	for _, match := range reCodeParameter.FindAllStringSubmatch(lang, -1) {
+		params[match[1]] = match[2] + match[3]
+	}
+
+	return params
+}
+
+// ParseCollapse returns true if code block should be collapsed, which is
+// specified either by "collapse" keyword or by collapse="true" parameter.
+func ParseCollapse(lang string) bool {
+	if value, ok := ParseCodeParameters(lang)["collapse"]; ok {
+		return value == "true"
+	}
+
+	for _, field := range strings.Fields(lang) {
+		if field == "collapse" {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (renderer ConfluenceRenderer) RenderNode(
 	writer io.Writer,
 	node *bf.Node,
 	entering bool,
 ) bf.WalkStatus {
+	if renderer.HeadingAnchors {
+		switch node.Type {
+		case bf.Heading:
+			if entering {
+				renderer.Stdlib.Templates.ExecuteTemplate(
+					writer,
+					"ac:anchor",
+					struct {
+						Name string
+					}{
+						renderer.anchor(node),
+					},
+				)
+			}
+
+		case bf.Link:
+			link := string(node.LinkData.Destination)
+			if strings.HasPrefix(link, "#") && len(link) > 1 {
+				if entering {
+					fmt.Fprintf(
+						writer,
+						`<ac:link ac:anchor="%s"><ac:link-body>`,
+						escapeAttribute(link[1:]),
+					)
+				} else {
+					fmt.Fprint(writer, `</ac:link-body></ac:link>`)
+				}
+
+				return bf.GoToNext
+			}
+		}
+	}
+
+	switch node.Type {
+	case bf.Heading:
+		if entering && renderer.HeadingNumbers > 0 &&
+			renderer.renderHeadingNumber(writer, node) {
+			return bf.GoToNext
+		}
+
+	case bf.List:
+		if entering && renderer.parseTaskList(node) {
+			fmt.Fprint(writer, "<ac:task-list>\n")
+
+			return bf.GoToNext
+		}
+
+		if _, ok := renderer.tasks[node.FirstChild]; !entering && ok {
+			fmt.Fprint(writer, "</ac:task-list>\n")
+
+			return bf.GoToNext
+		}
+
+		if entering && node.ListFlags&bf.ListTypeOrdered != 0 &&
+			renderer.renderOrderedList(writer, node) {
+			return bf.GoToNext
+		}
+
+	case bf.BlockQuote:
+		if entering && !renderer.parseAdmonition(node) {
+			renderer.parseAttribution(node)
+		}
+
+		if admonition, ok := renderer.admonitions[node]; ok {
+			renderer.renderAdmonition(writer, admonition, entering)
+
+			return bf.GoToNext
+		}
+
+	case bf.Paragraph:
+		if renderer.attributions[node] {
+			renderer.renderAttribution(writer, entering)
+
+			return bf.GoToNext
+		}
+
+	case bf.Table:
+		if renderer.renderWideTable(writer, node, entering) {
+			return bf.GoToNext
+		}
+
+	case bf.Item:
+		if task, ok := renderer.tasks[node]; ok {
+			renderer.renderTask(writer, task, entering)
+
+			return bf.GoToNext
+		}
+
+	case bf.Text:
+		if renderer.SubSuperscript && renderer.renderScripts(writer, node) {
+			return bf.GoToNext
+		}
+
+		if renderer.Mentions && renderer.renderMentions(writer, node) {
+			return bf.GoToNext
+		}
+
+	case bf.Link:
+		link := string(node.LinkData.Destination)
+
+		// only bare links like <https://example.com> or autolinked ones,
+		// which have link itself as text, are rendered as cards
+		if entering && nodeText(node) == link &&
+			matchDomains(link, renderer.SmartLinkDomains) {
+			fmt.Fprintf(
+				writer,
+				`<a href="%s" data-card-appearance="inline">%s</a>`,
+				escapeAttribute(link),
+				escapeAttribute(link),
+			)
+
+			return bf.SkipChildren
+		}
+
+		if entering && renderer.isNewWindowLink(link) {
+			fmt.Fprintf(writer, `<a href="%s"`, escapeAttribute(link))
+
+			if len(node.LinkData.Title) > 0 {
+				fmt.Fprintf(
+					writer,
+					` title="%s"`,
+					escapeAttribute(string(node.LinkData.Title)),
+				)
+			}
+
+			fmt.Fprint(writer, ` target="_blank" rel="noopener noreferrer">`)
+
+			return bf.GoToNext
+		}
+
+	case bf.Image:
+		alt := nodeText(node)
+
+		// alt text is used as image title, which is displayed on hover
+		if entering && len(node.LinkData.Title) == 0 {
+			node.LinkData.Title = []byte(alt)
+		}
+
+		// SVG attachments are rendered as ac:image as well, because some
+		// Confluence instances don't display them using <img>
+		if entering {
+			attributes := parseImageAttributes(node)
+			if attributes != nil || isSVGAttachment(node) {
+				renderer.renderImage(writer, node, attributes)
+
+				if renderer.ImageCaptions && alt != "" {
+					fmt.Fprintf(writer, "<br /><em>%s</em>", escapeAttribute(alt))
+				}
+
+				return bf.SkipChildren
+			}
+		}
+
+		if !entering && renderer.ImageCaptions && alt != "" {
+			renderer.Renderer.RenderNode(writer, node, entering)
+
+			fmt.Fprintf(writer, "<br /><em>%s</em>", escapeAttribute(alt))
+
+			return bf.GoToNext
+		}
+	}
+
 	if node.Type == bf.CodeBlock {
 		lang := string(node.Info)
 
+		title := ParseTitle(lang)
+		if value, ok := ParseCodeParameters(lang)["title"]; ok {
+			title = value
+		}
+
+		switch language := ParseLanguage(lang); language {
+		case "iframe", "widget":
+			if renderer.renderEmbed(writer, node, language) {
+				return bf.GoToNext
+			}
+
+		case "noformat", "text":
+			renderer.Stdlib.Templates.ExecuteTemplate(
+				writer,
+				"ac:noformat",
+				struct {
+					Collapse bool
+					Title    string
+					Text     string
+				}{
+					ParseCollapse(lang),
+					title,
+					strings.TrimSuffix(string(node.Literal), "\n"),
+				},
+			)
+
+			return bf.GoToNext
+		}
+
+		if ParseLanguage(lang) == "html-macro" {
+			if renderer.HTMLMacro {
+				renderer.Stdlib.Templates.ExecuteTemplate(
+					writer,
+					"ac:html",
+					struct {
+						Text string
+					}{
+						strings.TrimSuffix(string(node.Literal), "\n"),
+					},
+				)
+
+				return bf.GoToNext
+			}
+
+			log.Warningf(
+				nil,
+				"html-macro code block is rendered as code, "+
+					"because HTML macro is not enabled in configuration",
+			)
+		}
+
 		renderer.Stdlib.Templates.ExecuteTemplate(
 			writer,
 			"ac:code",
@@ -62,11 +399,13 @@ func (renderer ConfluenceRenderer) RenderNode(
 				Language string
 				Collapse bool
 				Title    string
+				Theme    string
 				Text     string
 			}{
-				ParseLanguage(lang),
-				strings.Contains(lang, "collapse"),
-				ParseTitle(lang),
+				CodeLanguage(ParseLanguage(lang), renderer.LanguageAliases),
+				ParseCollapse(lang),
+				title,
+				CodeTheme(ParseCodeParameters(lang)["theme"]),
 				strings.TrimSuffix(string(node.Literal), "\n"),
 			},
 		)
@@ -76,15 +415,135 @@ func (renderer ConfluenceRenderer) RenderNode(
 	return renderer.Renderer.RenderNode(writer, node, entering)
 }
 
+// anchor returns unique anchor name for given heading node. Headings with the
+// same slug are disambiguated by numeric suffix: slug, slug-1, slug-2, ...
+func (renderer ConfluenceRenderer) anchor(node *bf.Node) string {
+	slug := Slugify(nodeText(node))
+	if slug == "" {
+		slug = "section"
+	}
+
+	name := slug
+	for i := 1; renderer.anchors[name]; i++ {
+		name = fmt.Sprintf("%s-%d", slug, i)
+	}
+
+	renderer.anchors[name] = true
+
+	return name
+}
+
+// Slugify converts heading text into anchor name: letters and digits are
+// lowercased, any other characters are collapsed into single dash.
+func Slugify(text string) string {
+	var (
+		slug strings.Builder
+		dash bool
+	)
+
+	for _, char := range strings.ToLower(text) {
+		if unicode.IsLetter(char) || unicode.IsDigit(char) {
+			if dash && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+
+			slug.WriteRune(char)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return slug.String()
+}
+
+func nodeText(node *bf.Node) string {
+	var text strings.Builder
+
+	node.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if entering && (node.Type == bf.Text || node.Type == bf.Code) {
+			text.Write(node.Literal)
+		}
+
+		return bf.GoToNext
+	})
+
+	return text.String()
+}
+
+func escapeAttribute(value string) string {
+	return strings.NewReplacer(
+		`&`, `&amp;`,
+		`"`, `&quot;`,
+		`<`, `&lt;`,
+		`>`, `&gt;`,
+	).Replace(value)
+}
+
 // compileMarkdown will replace tags like <ac:rich-tech-body> with escaped
 // equivalent, because bf markdown parser replaces that tags with
 // <a href="ac:rich-text-body">ac:rich-text-body</a> for whatever reason.
 func CompileMarkdown(
 	markdown []byte,
 	stdlib *stdlib.Lib,
+	options CompileOptions,
 ) string {
 	log.Tracef(nil, "rendering markdown:\n%s", string(markdown))
 
+	if options.HeadingAnchors {
+		warnDuplicateHeadings(markdown)
+	}
+
+	if !options.StrictEntities {
+		markdown = escapeEntityEscapes(markdown)
+	}
+
+	html := renderMarkdown(markdown, stdlib, options)
+
+	result := NormalizeEntities(string(html), options.StrictEntities)
+
+	if !options.KeepComments {
+		result = StripComments(result)
+	}
+
+	result, removed := FilterMacros(
+		result,
+		options.AllowedMacros,
+		options.DeniedMacros,
+	)
+	for _, name := range removed {
+		log.Warningf(nil, "macro %q is not allowed and removed from page", name)
+	}
+
+	log.Tracef(nil, "rendered markdown to html:\n%s", result)
+
+	return result
+}
+
+// renderMarkdown renders markdown into HTML, markdown inside bodies of
+// macros and HTML containers is rendered as well.
+func renderMarkdown(
+	markdown []byte,
+	stdlib *stdlib.Lib,
+	options CompileOptions,
+) []byte {
+	markdown, fragments := extractStorageFragments(markdown)
+
+	for i, fragment := range fragments {
+		fragments[i] = compileRichTextBodies(fragment, func(body []byte) []byte {
+			// numbering of headings inside macros would be unrelated to
+			// numbering of the page
+			options := options
+			options.HeadingNumbers = 0
+
+			return renderMarkdown(body, stdlib, options)
+		})
+	}
+
+	markdown, fragments = extractHTMLContainers(markdown, fragments)
+
+	markdown = markOrderedListItems(markdown)
+
 	colon := regexp.MustCompile(`---bf-COLON---`)
 
 	tags := regexp.MustCompile(`<(/?\S+?):(\S+?)>`)
@@ -106,6 +565,26 @@ func CompileMarkdown(
 		),
 
 		Stdlib: stdlib,
+
+		HeadingAnchors: options.HeadingAnchors,
+		Mentions:       options.Mentions,
+		HTMLMacro:      options.HTMLMacro,
+		ImageCaptions:  options.ImageCaptions,
+		EmbedMacros:    options.EmbedMacros,
+		SubSuperscript: options.SubSuperscript,
+
+		SmartLinkDomains: options.SmartLinkDomains,
+		NewWindowDomains: options.NewWindowDomains,
+		InternalDomains:  options.InternalDomains,
+		LanguageAliases:  options.LanguageAliases,
+		WideTableColumns: options.WideTableColumns,
+		HeadingNumbers:   options.HeadingNumbers,
+
+		anchors:      map[string]bool{},
+		numbers:      make([]int, 6),
+		tasks:        map[*bf.Node]task{},
+		attributions: map[*bf.Node]bool{},
+		admonitions:  map[*bf.Node]admonition{},
 	}
 
 	html := bf.Run(
@@ -130,9 +609,9 @@ func CompileMarkdown(
 
 	html = colon.ReplaceAll(html, []byte(`:`))
 
-	log.Tracef(nil, "rendered markdown to html:\n%s", string(html))
+	html = unmarkOrderedListItems(html)
 
-	return string(html)
+	return restoreStorageFragments(html, fragments)
 }
 
 // DropDocumentLeadingH1 will drop leading H1 headings to prevent
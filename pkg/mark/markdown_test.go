@@ -1,11 +1,15 @@
 package mark
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/kovetskiy/mark/pkg/confluence"
 	"github.com/kovetskiy/mark/pkg/mark/stdlib"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,6 +22,39 @@ func text(lines ...string) string {
 	return strings.Join(lines, "\n")
 }
 
+// newUsersLib returns stdlib, which looks up users in fake Confluence, where
+// every user has account ID like id-<username>.
+func newUsersLib(t *testing.T) *stdlib.Lib {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			username := request.URL.Query().Get("username")
+			if request.URL.Path != "/rest/api/user" || username == "" {
+				writer.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			fmt.Fprintf(
+				writer,
+				`{"accountId": "id-%s", "username": "%s"}`,
+				username,
+				username,
+			)
+		},
+	))
+
+	t.Cleanup(server.Close)
+
+	lib, err := stdlib.New(
+		confluence.NewAPI(server.URL, "", "", nil, confluence.Options{}),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return lib
+}
+
 func TestCompileMarkdown(t *testing.T) {
 	test := assert.New(t)
 
@@ -44,7 +81,798 @@ func TestCompileMarkdown(t *testing.T) {
 		if err != nil {
 			panic(err)
 		}
-		actual := CompileMarkdown(markdown, lib)
+		actual := CompileMarkdown(markdown, lib, CompileOptions{})
 		test.EqualValues(string(html), actual, filename+" vs "+htmlname)
 	}
 }
+
+func TestSlugify(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal("getting-started", Slugify("Getting Started"))
+	test.Equal("what-s-new-in-v2-0", Slugify("What's new in v2.0?"))
+	test.Equal("привет-мир", Slugify("Привет, мир!"))
+	test.Equal("", Slugify("!!!"))
+}
+
+func TestCompileMarkdown_HeadingAnchors(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	actual := CompileMarkdown(
+		[]byte(text(
+			"# Setup",
+			"## Setup",
+			"## Setup 1",
+			"",
+			"[see setup](#setup)",
+		)),
+		lib,
+		CompileOptions{HeadingAnchors: true},
+	)
+
+	test.Contains(actual, `<ac:parameter ac:name="">setup</ac:parameter>`)
+	test.Contains(actual, `<ac:parameter ac:name="">setup-1</ac:parameter>`)
+	test.Contains(actual, `<ac:parameter ac:name="">setup-1-1</ac:parameter>`)
+	test.Contains(
+		actual,
+		`<ac:link ac:anchor="setup"><ac:link-body>see setup</ac:link-body></ac:link>`,
+	)
+}
+
+func TestCompileMarkdown_TaskList(t *testing.T) {
+	test := assert.New(t)
+
+	actual := CompileMarkdown(
+		[]byte(text(
+			"- [ ] first",
+			"- [x] 2024-12-01 second",
+			"- [ ] @alice 2024-12-15 third",
+			"",
+			"text",
+			"",
+			"- [ ] not a",
+			"- task list",
+		)),
+		newUsersLib(t),
+		CompileOptions{},
+	)
+
+	test.Contains(actual, text(
+		"<ac:task-list>",
+		"<ac:task>",
+		"<ac:task-status>incomplete</ac:task-status>",
+		"<ac:task-body>first</ac:task-body>",
+		"</ac:task>",
+		"<ac:task>",
+		"<ac:task-status>complete</ac:task-status>",
+		`<ac:task-body><time datetime="2024-12-01" /> second</ac:task-body>`,
+		"</ac:task>",
+		"<ac:task>",
+		"<ac:task-status>incomplete</ac:task-status>",
+		"<ac:task-body>"+
+			`<ac:link><ri:user ri:account-id="id-alice"/></ac:link> `+
+			`<time datetime="2024-12-15" /> third`+
+			"</ac:task-body>",
+		"</ac:task>",
+		"</ac:task-list>",
+	))
+
+	test.Contains(actual, "<li>[ ] not a</li>")
+}
+
+func TestCompileMarkdown_Mentions(t *testing.T) {
+	test := assert.New(t)
+
+	actual := CompileMarkdown(
+		[]byte(text(
+			"Ask @alice, not bob@example.com or `@carol`.",
+			"",
+			"```",
+			"@dave",
+			"```",
+			"",
+		)),
+		newUsersLib(t),
+		CompileOptions{Mentions: true},
+	)
+
+	test.Contains(
+		actual,
+		`<p>Ask <ac:link><ri:user ri:account-id="id-alice"/></ac:link>, `+
+			`not bob@example.com or <code>@carol</code>.</p>`,
+	)
+
+	test.Contains(actual, "@dave")
+	test.NotContains(actual, "id-carol")
+	test.NotContains(actual, "id-dave")
+}
+
+func TestCompileMarkdown_StorageMacroBody(t *testing.T) {
+	test := assert.New(t)
+
+	actual := CompileMarkdown(
+		[]byte(text(
+			`<ac:structured-macro ac:name="warning">`,
+			`<ac:rich-text-body>`,
+			"Don't run it in **production**:",
+			"",
+			"- first",
+			"- second",
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+			`<ac:structured-macro ac:name="info">`,
+			`<ac:rich-text-body><p>as *is*</p></ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+		)),
+		nil,
+		CompileOptions{},
+	)
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="warning">`,
+			`<ac:rich-text-body>`,
+			"<p>Don&rsquo;t run it in <strong>production</strong>:</p>",
+			"",
+			"<ul>",
+			"<li>first</li>",
+			"<li>second</li>",
+			"</ul>",
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+			`<ac:structured-macro ac:name="info">`,
+			`<ac:rich-text-body><p>as *is*</p></ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+		),
+		actual,
+	)
+}
+
+func TestCompileMarkdown_StorageMacros(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	macro := text(
+		`<ac:structured-macro ac:name="code">`,
+		`<ac:plain-text-body><![CDATA[a *b* <c>]]></ac:plain-text-body>`,
+		`</ac:structured-macro>`,
+	)
+
+	actual := CompileMarkdown(
+		[]byte(text(
+			"text",
+			"",
+			macro,
+			"",
+			"`<ac:structured-macro ac:name=\"x\"/>`",
+		)),
+		lib,
+		CompileOptions{},
+	)
+
+	test.Equal(
+		text(
+			"<p>text</p>",
+			"",
+			macro,
+			"",
+			`<p><code>&lt;ac:structured-macro ac:name=&quot;x&quot;/&gt;</code></p>`,
+			"",
+		),
+		actual,
+	)
+}
+
+func TestParseCollapse(t *testing.T) {
+	test := assert.New(t)
+
+	test.True(ParseCollapse(`bash collapse`))
+	test.True(ParseCollapse(`log collapse="true"`))
+	test.True(ParseCollapse(`log collapse=true`))
+	test.False(ParseCollapse(`log collapse="false"`))
+	test.False(ParseCollapse(`log`))
+
+	test.Equal("log", ParseLanguage(`log collapse="true"`))
+	test.Equal("", ParseLanguage(`collapse="true"`))
+}
+
+func TestCompileMarkdown_OrderedListContinuation(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	markdown := "1. one\n2. two\n\n```bash\nls\n```\n\n3. three\n4. four\n"
+
+	html := CompileMarkdown([]byte(markdown), lib, CompileOptions{})
+
+	test.Contains(html, "<ol>\n<li>one</li>")
+	test.Contains(html, `<ol start="3">`+"\n<li>three</li>")
+	test.NotContains(html, "MARKLISTITEM")
+}
+
+func TestCompileMarkdown_Entities(t *testing.T) {
+	test := assert.New(t)
+
+	html := CompileMarkdown(
+		[]byte("AT&amp;T &copy; 2020 &lt;b&gt; <code>&amp;lt;</code>\n"),
+		nil,
+		CompileOptions{},
+	)
+
+	test.NotContains(html, "&amp;copy;")
+	test.Contains(html, "&lt;b&gt;")
+	test.Contains(html, "<code>&amp;lt;</code>")
+	test.Contains(html, "AT&amp;T")
+
+	test.Equal(
+		"<p>Use <code>&amp;lt;</code> for &lt; and \\&lt; or &amp;lt;</p>\n",
+		CompileMarkdown(
+			[]byte("Use `&lt;` for &lt; and \\\\&lt; or \\&lt;\n"),
+			nil,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestCompileMarkdown_ImageAlt(t *testing.T) {
+	test := assert.New(t)
+
+	markdown := []byte("![Deployment diagram](diagram.png)\n")
+
+	test.Equal(
+		`<p><img src="diagram.png" alt="Deployment diagram" `+
+			`title="Deployment diagram" /></p>`+"\n",
+		CompileMarkdown(markdown, nil, CompileOptions{}),
+	)
+
+	test.Equal(
+		`<p><img src="diagram.png" alt="Deployment diagram" `+
+			`title="Deployment diagram" /><br /><em>Deployment diagram</em></p>`+"\n",
+		CompileMarkdown(markdown, nil, CompileOptions{ImageCaptions: true}),
+	)
+}
+
+func TestCompileMarkdown_SmartLinks(t *testing.T) {
+	test := assert.New(t)
+
+	html := CompileMarkdown(
+		[]byte(
+			"See https://github.com/kovetskiy/mark/issues/1, "+
+				"[issue](https://github.com/kovetskiy/mark/issues/2) "+
+				"and https://example.com\n",
+		),
+		nil,
+		CompileOptions{SmartLinkDomains: []string{"github.com"}},
+	)
+
+	test.Contains(
+		html,
+		`<a href="https://github.com/kovetskiy/mark/issues/1" `+
+			`data-card-appearance="inline">`+
+			`https://github.com/kovetskiy/mark/issues/1</a>`,
+	)
+	test.Contains(
+		html,
+		`<a href="https://github.com/kovetskiy/mark/issues/2">issue</a>`,
+	)
+	test.Contains(
+		html,
+		`<a href="https://example.com">https://example.com</a>`,
+	)
+}
+
+func TestCompileMarkdown_Embed(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	markdown := []byte(text(
+		"```iframe width=800 height=600",
+		"https://grafana.example.com/d/abc?a=1&b=2",
+		"```",
+		"",
+		"```widget",
+		"javascript:alert(1)",
+		"```",
+		"",
+	))
+
+	html := CompileMarkdown(markdown, lib, CompileOptions{EmbedMacros: true})
+
+	test.Contains(
+		html,
+		text(
+			`<ac:structured-macro ac:name="iframe">`,
+			`<ac:parameter ac:name="src">`+
+				`<ri:url ri:value="https://grafana.example.com/d/abc?a=1&amp;b=2" />`+
+				`</ac:parameter>`,
+			`<ac:parameter ac:name="width">800</ac:parameter>`,
+			`<ac:parameter ac:name="height">600</ac:parameter>`,
+			`</ac:structured-macro>`,
+		),
+	)
+	test.NotContains(html, `ac:name="widget"`)
+	test.Contains(html, `<![CDATA[javascript:alert(1)]]>`)
+
+	html = CompileMarkdown(markdown, lib, CompileOptions{})
+
+	test.NotContains(html, `ac:name="iframe"`)
+}
+
+func TestCompileMarkdown_WideTables(t *testing.T) {
+	test := assert.New(t)
+
+	markdown := []byte(text(
+		"| a | b | c |",
+		"|---|---|---|",
+		"| 1 | 2 | 3 |",
+		"",
+		"| a | b |",
+		"|---|---|",
+		"| 1 | 2 |",
+		"",
+	))
+
+	html := CompileMarkdown(markdown, nil, CompileOptions{WideTableColumns: 3})
+
+	test.Equal(1, strings.Count(html, `<div class="table-wrap"`))
+	test.Contains(
+		html,
+		`<div class="table-wrap" style="overflow-x: auto;">`+"\n<table>",
+	)
+	test.Contains(html, "</table>\n</div>\n\n<table>")
+
+	html = CompileMarkdown(markdown, nil, CompileOptions{})
+
+	test.NotContains(html, `<div class="table-wrap"`)
+}
+
+func TestCompileMarkdown_SubSuperscript(t *testing.T) {
+	test := assert.New(t)
+
+	markdown := []byte("H~2~O and x^2^, a^b\\ c^, ~~strike~~ and 2 ^ 3\n")
+
+	test.Equal(
+		"<p>H<sub>2</sub>O and x<sup>2</sup>, a<sup>b c</sup>, "+
+			"<del>strike</del> and 2 ^ 3</p>\n",
+		CompileMarkdown(markdown, nil, CompileOptions{SubSuperscript: true}),
+	)
+
+	test.Equal(
+		"<p>H~2~O and x^2^, a^b\\ c^, <del>strike</del> and 2 ^ 3</p>\n",
+		CompileMarkdown(markdown, nil, CompileOptions{}),
+	)
+}
+
+func TestCompileMarkdown_NestedMarkdown(t *testing.T) {
+	test := assert.New(t)
+
+	actual := CompileMarkdown(
+		[]byte(text(
+			`<ac:structured-macro ac:name="warning">`,
+			`<ac:rich-text-body>`,
+			"Don't run it in **production**:",
+			"",
+			"- first",
+			"- second",
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+			`<ac:structured-macro ac:name="info">`,
+			`<ac:rich-text-body><p>as *is*</p></ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+			`<div class="columns">`,
+			"",
+			"1. one",
+			"",
+			`</div>`,
+			"",
+			`<div>`,
+			"*raw*",
+			`</div>`,
+			"",
+		)),
+		nil,
+		CompileOptions{},
+	)
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="warning">`,
+			`<ac:rich-text-body>`,
+			"<p>Don&rsquo;t run it in <strong>production</strong>:</p>",
+			"",
+			"<ul>",
+			"<li>first</li>",
+			"<li>second</li>",
+			"</ul>",
+			`</ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+			`<ac:structured-macro ac:name="info">`,
+			`<ac:rich-text-body><p>as *is*</p></ac:rich-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+			`<div class="columns">`,
+			"",
+			"<ol>",
+			"<li>one</li>",
+			"</ol>",
+			"",
+			`</div>`,
+			"",
+			`<div>`,
+			"*raw*",
+			`</div>`,
+			"",
+		),
+		actual,
+	)
+
+	test.Equal(
+		text(`<div>`, "", "text", `</div>`, ""),
+		CompileMarkdown(
+			[]byte(text(`<div>`, "", "text", `</div>`, "")),
+			nil,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestCompileMarkdown_CodeTheme(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	html := CompileMarkdown(
+		[]byte("```java theme=midnight\nclass A {}\n```\n"),
+		lib,
+		CompileOptions{},
+	)
+
+	test.Contains(html, `<ac:parameter ac:name="theme">Midnight</ac:parameter>`)
+
+	html = CompileMarkdown(
+		[]byte("```java theme=Solarized\nclass A {}\n```\n"),
+		lib,
+		CompileOptions{},
+	)
+
+	test.NotContains(html, `ac:name="theme"`)
+}
+
+func TestCompileMarkdown_BlockquoteAttribution(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		text(
+			"<blockquote>",
+			"<p>Simplicity is prerequisite for reliability.</p>",
+			"<p><cite>— Edsger W. Dijkstra, <em>EWD498</em></cite></p>",
+			"</blockquote>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte(text(
+				"> Simplicity is prerequisite for reliability.",
+				"> — Edsger W. Dijkstra, *EWD498*",
+			)),
+			nil,
+			CompileOptions{},
+		),
+	)
+
+	test.Equal(
+		text(
+			"<blockquote>",
+			"<p>First.</p>",
+			"",
+			"<p>Second.</p>",
+			"<p><cite>&ndash; Author</cite></p>",
+			"</blockquote>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte(text("> First.", ">", "> Second.", ">", "> -- Author")),
+			nil,
+			CompileOptions{},
+		),
+	)
+
+	test.Equal(
+		text(
+			"<blockquote>",
+			"<p>Plain quote with — dash.</p>",
+			"</blockquote>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte("> Plain quote with — dash."),
+			nil,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestCompileMarkdown_Admonition(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="warning">`,
+			`<ac:parameter ac:name="title">Data loss &amp; recovery</ac:parameter>`,
+			"<ac:rich-text-body>",
+			"<p>Backup <em>everything</em>.</p>",
+			"</ac:rich-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte(text(
+				"> [!WARNING]",
+				"> **Data loss & recovery**",
+				"> Backup *everything*.",
+			)),
+			nil,
+			CompileOptions{},
+		),
+	)
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="panel">`,
+			`<ac:parameter ac:name="title">Summary</ac:parameter>`,
+			"<ac:rich-text-body>",
+			"<p>Body.</p>",
+			"</ac:rich-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte(text("> [!panel]", ">", "> ## Summary", ">", "> Body.")),
+			nil,
+			CompileOptions{},
+		),
+	)
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="tip">`,
+			"<ac:rich-text-body>",
+			"<p><strong>Bold</strong> start of body.</p>",
+			"</ac:rich-text-body>",
+			"</ac:structured-macro>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte(text("> [!TIP]", "> **Bold** start of body.")),
+			nil,
+			CompileOptions{},
+		),
+	)
+
+	test.Equal(
+		text(
+			"<blockquote>",
+			"<p>[!NOTE] not an admonition.</p>",
+			"</blockquote>",
+			"",
+		),
+		CompileMarkdown(
+			[]byte("> [!NOTE] not an admonition."),
+			nil,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestCompileMarkdown_Noformat(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	test.Equal(
+		text(
+			`<ac:structured-macro ac:name="noformat">`,
+			`<ac:parameter ac:name="title">Output</ac:parameter>`,
+			`<ac:plain-text-body><![CDATA[  a  *b*`,
+			`    c]]></ac:plain-text-body>`,
+			`</ac:structured-macro>`,
+			"",
+		),
+		CompileMarkdown(
+			[]byte("```noformat title Output\n  a  *b*\n    c\n```\n"),
+			lib,
+			CompileOptions{},
+		),
+	)
+
+	html := CompileMarkdown(
+		[]byte("```text\nplain\n```\n"),
+		lib,
+		CompileOptions{},
+	)
+
+	test.Contains(html, `<ac:structured-macro ac:name="noformat">`)
+	test.NotContains(html, `ac:name="code"`)
+}
+
+func TestCompileMarkdown_ImageAttributes(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	test.Equal(
+		text(
+			`<p><ac:image ac:alt="screen" ac:title="screen" `+
+				`ac:width="300" ac:border="true" ac:align="center" ac:thumbnail="true">`+
+				`<ri:attachment ri:filename="screen shot.png" />`+
+				`</ac:image> text</p>`,
+			"",
+		),
+		CompileMarkdown(
+			[]byte(
+				"![screen](/wiki/download/attachments/123/screen%20shot.png?version%3D1)"+
+					"{width=300px border align=Center thumbnail} text\n",
+			),
+			lib,
+			CompileOptions{},
+		),
+	)
+
+	test.Equal(
+		text(
+			`<p><ac:image ac:alt="logo" ac:title="Logo" ac:height="50">`+
+				`<ri:url ri:value="https://example.com/logo.png?a=1&amp;b=2" />`+
+				`</ac:image></p>`,
+			"",
+		),
+		CompileMarkdown(
+			[]byte(
+				"![logo](https://example.com/logo.png?a=1&b=2 \"Logo\"){height=50 unknown}\n",
+			),
+			lib,
+			CompileOptions{},
+		),
+	)
+
+	test.Contains(
+		CompileMarkdown([]byte("![logo](logo.png) {width=50}\n"), lib, CompileOptions{}),
+		`<img src="logo.png"`,
+	)
+
+	test.Equal(
+		text(
+			`<p><ac:image ac:alt="flow" ac:title="flow">`+
+				`<ri:attachment ri:filename="flow.svg" />`+
+				`</ac:image></p>`,
+			"",
+		),
+		CompileMarkdown(
+			[]byte("![flow](/download/attachments/123/flow.svg?version%3D1)\n"),
+			lib,
+			CompileOptions{},
+		),
+	)
+}
+
+func TestCompileMarkdown_HeadingNumbers(t *testing.T) {
+	test := assert.New(t)
+
+	lib, err := stdlib.New(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	markdown := []byte(text(
+		"# Title",
+		"## Scope",
+		"## Terms",
+		"### Roles",
+		"### Documents",
+		"## Rules",
+		"#### Deep",
+		"",
+	))
+
+	test.Equal(
+		text(
+			`<h1 id="title">Title</h1>`,
+			"",
+			`<h2 id="scope">1 Scope</h2>`,
+			"",
+			`<h2 id="terms">2 Terms</h2>`,
+			"",
+			`<h3 id="roles">2.1 Roles</h3>`,
+			"",
+			`<h3 id="documents">2.2 Documents</h3>`,
+			"",
+			`<h2 id="rules">3 Rules</h2>`,
+			"",
+			`<h4 id="deep">3.0.1 Deep</h4>`,
+			"",
+		),
+		CompileMarkdown(markdown, lib, CompileOptions{HeadingNumbers: 2}),
+	)
+
+	html := CompileMarkdown(
+		markdown,
+		lib,
+		CompileOptions{HeadingNumbers: 1, HeadingAnchors: true},
+	)
+
+	test.Contains(html, `<h1 id="title">1 Title</h1>`)
+	test.Contains(html, `<ac:parameter ac:name="">roles</ac:parameter>`)
+	test.Contains(html, `<h3 id="roles">1.2.1 Roles</h3>`)
+}
+
+func TestCompileMarkdown_NewWindowLinks(t *testing.T) {
+	test := assert.New(t)
+
+	markdown := []byte(text(
+		`[docs](https://docs.example.com/a?b=1&c=2 "Docs")`,
+		"[wiki](https://wiki.example.com/display/DOC)",
+		"[other](https://other.org/)",
+		"[local](../page)",
+		"[mail](mailto:team@example.com)",
+	))
+
+	options := CompileOptions{
+		NewWindowDomains: []string{"example.com"},
+		InternalDomains:  []string{"wiki.example.com"},
+	}
+
+	test.Equal(
+		text(
+			`<p><a href="https://docs.example.com/a?b=1&amp;c=2" title="Docs" `+
+				`target="_blank" rel="noopener noreferrer">docs</a>`,
+			`<a href="https://wiki.example.com/display/DOC">wiki</a>`,
+			`<a href="https://other.org/">other</a>`,
+			`<a href="../page">local</a>`,
+			`<a href="mailto:team@example.com">mail</a></p>`,
+			"",
+		),
+		CompileMarkdown(markdown, nil, options),
+	)
+
+	options.NewWindowDomains = []string{"*"}
+
+	test.Contains(
+		CompileMarkdown(markdown, nil, options),
+		`<a href="https://other.org/" target="_blank" rel="noopener noreferrer">`,
+	)
+
+	test.NotContains(
+		CompileMarkdown(markdown, nil, CompileOptions{}),
+		`target="_blank"`,
+	)
+}
@@ -0,0 +1,85 @@
+package mark
+
+import (
+	"io"
+	"regexp"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+var reMention = regexp.MustCompile(`@([A-Za-z0-9_](?:[A-Za-z0-9_.-]*[A-Za-z0-9_])?)`)
+
+// renderMentions renders text node replacing @username references with user
+// mentions. It returns false if text node doesn't contain any mentions.
+func (renderer ConfluenceRenderer) renderMentions(
+	writer io.Writer,
+	node *bf.Node,
+) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.Link {
+			return false
+		}
+	}
+
+	var (
+		text    = node.Literal
+		matches = [][]int{}
+	)
+
+	for _, match := range reMention.FindAllSubmatchIndex(text, -1) {
+		// skip emails and similar text like foo@bar
+		if match[0] > 0 && isWordByte(text[match[0]-1]) {
+			continue
+		}
+
+		matches = append(matches, match)
+	}
+
+	if len(matches) == 0 {
+		return false
+	}
+
+	plain := func(literal []byte) {
+		if len(literal) == 0 {
+			return
+		}
+
+		renderer.Renderer.RenderNode(
+			writer,
+			&bf.Node{
+				Type:    bf.Text,
+				Parent:  node.Parent,
+				Literal: literal,
+			},
+			true,
+		)
+	}
+
+	offset := 0
+	for _, match := range matches {
+		plain(text[offset:match[0]])
+
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:link:username",
+			struct {
+				Name string
+			}{
+				string(text[match[2]:match[3]]),
+			},
+		)
+
+		offset = match[1]
+	}
+
+	plain(text[offset:])
+
+	return true
+}
+
+func isWordByte(char byte) bool {
+	return char == '_' || char == '.' || char == '-' ||
+		(char >= 'a' && char <= 'z') ||
+		(char >= 'A' && char <= 'Z') ||
+		(char >= '0' && char <= '9')
+}
@@ -4,10 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/reconquest/karma-go"
 	"github.com/reconquest/pkg/log"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -19,6 +25,36 @@ const (
 	HeaderAttachment = `Attachment`
 	HeaderLabel      = `Label`
 	HeaderInclude    = `Include`
+	HeaderPrepend    = `Prepend`
+	HeaderAppend     = `Append`
+	HeaderAppearance = `Appearance`
+	HeaderDate       = `Date`
+	HeaderStatus     = `Status`
+	HeaderPageID     = `PageID`
+	HeaderVersion    = `Version`
+	HeaderURL        = `URL`
+	HeaderWatchers   = `Watchers`
+	HeaderAuthor     = `Author`
+
+	HeaderAttachmentsDir     = `AttachmentsDir`
+	HeaderOptionalAttachment = `OptionalAttachment`
+	HeaderRenameFrom         = `RenameFrom`
+)
+
+const (
+	TypePage     = `page`
+	TypeBlogPost = `blogpost`
+)
+
+const (
+	StatusCurrent  = `current`
+	StatusDraft    = `draft`
+	StatusArchived = `archived`
+)
+
+const (
+	AppearanceFullWidth = `full-width`
+	AppearanceDefault   = `default`
 )
 
 type Meta struct {
@@ -29,6 +65,46 @@ type Meta struct {
 	Layout      string
 	Attachments map[string]string
 	Labels      []string
+	Prepend     string
+	Append      string
+	Appearance  string
+
+	// OptionalAttachments are attachments, which are skipped with warning
+	// if they are not found, see SkipMissingAttachments.
+	OptionalAttachments map[string]bool
+
+	// Date is a posting day of blog post in YYYY-MM-DD format, blog posts are
+	// identified by title and posting day together.
+	Date string
+
+	// Status is either current, draft or archived, draft pages are not
+	// published.
+	Status string
+
+	// PageID pins the page by its ID instead of finding it by title.
+	PageID string
+
+	// Watchers are usernames of users which are added as page watchers.
+	Watchers []string
+
+	// Author is a username of user which created page is attributed to.
+	Author string
+
+	// AttachmentsDir is a directory, relative to directory of markdown
+	// file, which attachment paths are resolved against.
+	AttachmentsDir string
+
+	// ParentID is an ID of parent page, which takes precedence over Parents,
+	// it's set from navigation index.
+	ParentID string
+
+	// Version is a version of the page after it was last updated, which is
+	// written by --write-back.
+	Version int64
+
+	// RenameFrom are previous titles of the page, redirect pages pointing to
+	// the page are created at these titles.
+	RenameFrom []string
 }
 
 var (
@@ -42,6 +118,11 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 		offset int
 	)
 
+	data, err := convertFrontMatter(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	scanner := bufio.NewScanner(bytes.NewBuffer(data))
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -50,8 +131,6 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 			return nil, nil, err
 		}
 
-		offset += len(line) + 1
-
 		matches := reHeaderPatternV2.FindStringSubmatch(line)
 		if matches == nil {
 			matches = reHeaderPatternV1.FindStringSubmatch(line)
@@ -67,13 +146,18 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 			)
 		}
 
+		// lines following headers are part of contents, even if there is no
+		// empty line between them, like thematic break (---)
+		offset += len(line) + 1
+
 		if meta == nil {
 			meta = &Meta{}
-			meta.Type = "page" //Default if not specified
+			meta.Type = TypePage //Default if not specified
 			meta.Attachments = make(map[string]string)
+			meta.OptionalAttachments = make(map[string]bool)
 		}
 
-		header := strings.Title(matches[1])
+		header := normalizeHeader(matches[1])
 
 		var value string
 		if len(matches) > 1 {
@@ -88,7 +172,17 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 			meta.Space = strings.TrimSpace(value)
 
 		case HeaderType:
-			meta.Type = strings.TrimSpace(value)
+			if value != TypePage && value != TypeBlogPost {
+				return nil, nil, fmt.Errorf(
+					"unexpected %s header value: %q, expected %q or %q",
+					HeaderType,
+					value,
+					TypePage,
+					TypeBlogPost,
+				)
+			}
+
+			meta.Type = value
 
 		case HeaderTitle:
 			meta.Title = strings.TrimSpace(value)
@@ -99,9 +193,97 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 		case HeaderAttachment:
 			meta.Attachments[value] = value
 
+		case HeaderOptionalAttachment:
+			meta.Attachments[value] = value
+			meta.OptionalAttachments[value] = true
+
 		case HeaderLabel:
 			meta.Labels = append(meta.Labels, value)
 
+		case HeaderPrepend:
+			meta.Prepend = value
+
+		case HeaderAppend:
+			meta.Append = value
+
+		case HeaderAppearance:
+			if value != AppearanceFullWidth && value != AppearanceDefault {
+				return nil, nil, fmt.Errorf(
+					"unexpected %s header value: %q, expected %q or %q",
+					HeaderAppearance,
+					value,
+					AppearanceFullWidth,
+					AppearanceDefault,
+				)
+			}
+
+			meta.Appearance = value
+
+		case HeaderStatus:
+			if value != StatusCurrent && value != StatusDraft &&
+				value != StatusArchived {
+				return nil, nil, fmt.Errorf(
+					"unexpected %s header value: %q, expected %q, %q or %q",
+					HeaderStatus,
+					value,
+					StatusCurrent,
+					StatusDraft,
+					StatusArchived,
+				)
+			}
+
+			meta.Status = value
+
+		case HeaderDate:
+			_, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return nil, nil, fmt.Errorf(
+					"unexpected %s header value: %q, expected date in "+
+						"YYYY-MM-DD format",
+					HeaderDate,
+					value,
+				)
+			}
+
+			meta.Date = value
+
+		case HeaderPageID:
+			meta.PageID = value
+
+		case HeaderAttachmentsDir:
+			meta.AttachmentsDir = value
+
+		case HeaderAuthor:
+			meta.Author = value
+
+		case HeaderWatchers:
+			for _, watcher := range strings.Split(value, ",") {
+				if watcher = strings.TrimSpace(watcher); watcher != "" {
+					meta.Watchers = append(meta.Watchers, watcher)
+				}
+			}
+
+		case HeaderVersion:
+			version, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || version < 1 {
+				return nil, nil, fmt.Errorf(
+					"unexpected %s header value: %q, expected positive number",
+					HeaderVersion,
+					value,
+				)
+			}
+
+			meta.Version = version
+
+		case HeaderRenameFrom:
+			if value != "" {
+				meta.RenameFrom = append(meta.RenameFrom, value)
+			}
+
+		case HeaderURL:
+			// Written by --write-back for reference only
+			continue
+
 		case HeaderInclude:
 			// Includes are parsed by a different func
 			continue
@@ -122,19 +304,386 @@ func ExtractMeta(data []byte) (*Meta, []byte, error) {
 		return nil, data, nil
 	}
 
-	if meta.Space == "" {
-		return nil, nil, fmt.Errorf(
-			"space key is not set (%s header is not set)",
-			HeaderSpace,
-		)
+	// empty line separating headers from contents
+	if offset < len(data) && data[offset] == '\n' {
+		offset++
 	}
 
-	if meta.Title == "" {
-		return nil, nil, fmt.Errorf(
-			"page title is not set (%s header is not set)",
-			HeaderTitle,
-		)
+	if offset > len(data) {
+		offset = len(data)
 	}
 
 	return meta, data[offset:], nil
 }
+
+var reAttachmentHeader = regexp.MustCompile(
+	`(?m)^[ \t]*<!--\s*Attachment:\s*(.*?)\s*-->[ \t]*(?:\n|$)`,
+)
+
+// ExtractAttachmentHeaders removes Attachment headers found in contents,
+// which come from included templates and macros, and returns their paths,
+// so attachments referenced by them are uploaded as well. Headers inside
+// code blocks are left as is.
+func ExtractAttachmentHeaders(markdown []byte) ([]string, []byte) {
+	var (
+		code   = codeRanges(markdown)
+		paths  = []string{}
+		buffer bytes.Buffer
+		offset int
+	)
+
+	for _, match := range reAttachmentHeader.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		paths = append(paths, string(markdown[match[2]:match[3]]))
+
+		buffer.Write(markdown[offset:match[0]])
+
+		offset = match[1]
+	}
+
+	buffer.Write(markdown[offset:])
+
+	return paths, buffer.Bytes()
+}
+
+// convertFrontMatter converts YAML front matter, which is used by many other
+// tools, into headers. Front matter should start at the first line of
+// document with --- and end with --- or ... line. Lines with --- found
+// anywhere else are thematic breaks and are left as is.
+// normalizeHeader returns canonical name of header, so headers like pageId or
+// url are recognized regardless of case.
+func normalizeHeader(name string) string {
+	for _, header := range []string{
+		HeaderParent,
+		HeaderSpace,
+		HeaderType,
+		HeaderTitle,
+		HeaderLayout,
+		HeaderAttachment,
+		HeaderLabel,
+		HeaderInclude,
+		HeaderPrepend,
+		HeaderAppend,
+		HeaderAppearance,
+		HeaderDate,
+		HeaderStatus,
+		HeaderPageID,
+		HeaderVersion,
+		HeaderURL,
+		HeaderWatchers,
+		HeaderAuthor,
+		HeaderAttachmentsDir,
+		HeaderOptionalAttachment,
+		HeaderRenameFrom,
+	} {
+		if strings.EqualFold(name, header) {
+			return header
+		}
+	}
+
+	return strings.Title(name)
+}
+
+func convertFrontMatter(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("---\n")) {
+		return data, nil
+	}
+
+	end := reFrontMatterEnd.FindIndex(data[len("---\n"):])
+	if end == nil {
+		return data, nil
+	}
+
+	contents := data[len("---\n") : len("---\n")+end[0]]
+	rest := data[len("---\n")+end[1]:]
+
+	// document can start with thematic break as well, so only valid YAML
+	// mapping is considered as front matter
+	var fields yaml.MapSlice
+
+	err := yaml.Unmarshal(contents, &fields)
+	if err != nil || len(fields) == 0 {
+		return data, nil
+	}
+
+	var headers bytes.Buffer
+
+	for _, field := range fields {
+		values := []interface{}{field.Value}
+		if list, ok := field.Value.([]interface{}); ok {
+			values = list
+		}
+
+		key := fmt.Sprint(field.Key)
+		switch {
+		case strings.EqualFold(key, "attachments"):
+			key = HeaderAttachment
+
+		case strings.EqualFold(key, "rename_from"):
+			key = HeaderRenameFrom
+		}
+
+		for _, value := range values {
+			if attachment, ok := value.(yaml.MapSlice); ok &&
+				strings.EqualFold(key, HeaderAttachment) {
+				header, err := frontMatterAttachment(attachment)
+				if err != nil {
+					return nil, err
+				}
+
+				headers.WriteString(header)
+
+				continue
+			}
+
+			switch value.(type) {
+			case []interface{}, yaml.MapSlice, map[interface{}]interface{}:
+				return nil, fmt.Errorf(
+					"unexpected front matter value of %q: %v",
+					field.Key,
+					value,
+				)
+			}
+
+			fmt.Fprintf(&headers, "<!-- %v: %v -->\n", key, value)
+		}
+	}
+
+	return append(headers.Bytes(), rest...), nil
+}
+
+// frontMatterAttachment converts attachment specified in front matter as
+// mapping like {path: screenshot.png, optional: true} into header.
+func frontMatterAttachment(fields yaml.MapSlice) (string, error) {
+	var (
+		path     string
+		optional bool
+	)
+
+	for _, field := range fields {
+		switch field.Key {
+		case "path":
+			path = fmt.Sprint(field.Value)
+
+		case "optional":
+			value, ok := field.Value.(bool)
+			if !ok {
+				return "", fmt.Errorf(
+					"unexpected front matter value of attachment "+
+						"optional field: %v, expected true or false",
+					field.Value,
+				)
+			}
+
+			optional = value
+
+		default:
+			return "", fmt.Errorf(
+				"unexpected front matter attachment field: %v",
+				field.Key,
+			)
+		}
+	}
+
+	if path == "" {
+		return "", fmt.Errorf(
+			"front matter attachment doesn't specify path: %v",
+			fields,
+		)
+	}
+
+	header := HeaderAttachment
+	if optional {
+		header = HeaderOptionalAttachment
+	}
+
+	return fmt.Sprintf("<!-- %s: %s -->\n", header, path), nil
+}
+
+// WriteBackHeaders sets PageID, Version and URL headers of the document to
+// given values, replacing previous ones. Headers are written into front
+// matter if document has one, otherwise they are added after other headers.
+// Contents of the document are left intact.
+func WriteBackHeaders(
+	data []byte,
+	pageID string,
+	version int64,
+	url string,
+) []byte {
+	managed := map[string]bool{
+		HeaderPageID:  true,
+		HeaderVersion: true,
+		HeaderURL:     true,
+	}
+
+	values := [][2]string{
+		{HeaderPageID, pageID},
+		{HeaderVersion, fmt.Sprint(version)},
+		{HeaderURL, url},
+	}
+
+	var (
+		result  bytes.Buffer
+		headers []string
+		offset  int
+	)
+
+	if converted, _ := convertFrontMatter(data); !bytes.Equal(converted, data) {
+		end := reFrontMatterEnd.FindIndex(data[len("---\n"):])
+
+		offset = len("---\n") + end[0]
+
+		for _, line := range strings.SplitAfter(
+			string(data[len("---\n"):offset]),
+			"\n",
+		) {
+			key := strings.TrimSpace(strings.SplitN(line, ":", 2)[0])
+			if line == "" || managed[normalizeHeader(key)] {
+				continue
+			}
+
+			headers = append(headers, line)
+		}
+
+		result.WriteString("---\n")
+		result.WriteString(strings.Join(headers, ""))
+
+		for _, value := range values {
+			fmt.Fprintf(&result, "%s: %q\n", value[0], value[1])
+		}
+
+		result.Write(data[offset:])
+
+		return result.Bytes()
+	}
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		matches := reHeaderPatternV2.FindStringSubmatch(line)
+		if matches == nil {
+			matches = reHeaderPatternV1.FindStringSubmatch(line)
+		}
+
+		if matches == nil {
+			break
+		}
+
+		offset += len(line)
+
+		if managed[normalizeHeader(matches[1])] {
+			continue
+		}
+
+		headers = append(headers, line)
+	}
+
+	result.WriteString(strings.Join(headers, ""))
+
+	if len(headers) > 0 && !strings.HasSuffix(headers[len(headers)-1], "\n") {
+		result.WriteString("\n")
+	}
+
+	for _, value := range values {
+		fmt.Fprintf(&result, "<!-- %s: %s -->\n", value[0], value[1])
+	}
+
+	// document without headers is separated from new ones by blank line
+	if offset == 0 {
+		result.WriteString("\n")
+	}
+
+	result.Write(data[offset:])
+
+	return result.Bytes()
+}
+
+var reFrontMatterEnd = regexp.MustCompile(`(?m)^(---|\.\.\.)[ \t]*(\n|$)`)
+
+// ApplyDefaults sets space and parent for metadata which doesn't specify
+// them explicitly.
+func (meta *Meta) ApplyDefaults(space string, parent string) {
+	if meta.Space == "" {
+		meta.Space = space
+	}
+
+	// blog posts don't have parents
+	if len(meta.Parents) == 0 && parent != "" && meta.Type != TypeBlogPost {
+		meta.Parents = []string{parent}
+	}
+}
+
+// AddLabels adds given labels to the metadata, skipping already listed ones.
+func (meta *Meta) AddLabels(labels ...string) {
+	for _, label := range labels {
+		found := false
+		for _, existing := range meta.Labels {
+			if existing == label {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			meta.Labels = append(meta.Labels, label)
+		}
+	}
+}
+
+// TitleFromFilename derives page title from markdown file name using
+// specified transforms, which are applied in order:
+//   - spaces: replace dashes and underscores with spaces;
+//   - title: capitalize first letter of every word.
+func TitleFromFilename(path string, transforms []string) (string, error) {
+	title := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	for _, transform := range transforms {
+		switch transform {
+		case "spaces":
+			title = strings.NewReplacer("-", " ", "_", " ").Replace(title)
+
+		case "title":
+			title = strings.Title(title)
+
+		default:
+			return "", fmt.Errorf("unknown title transform: %q", transform)
+		}
+	}
+
+	return strings.TrimSpace(title), nil
+}
+
+// RenderTitle executes title like "Weekly Status — {{ .week }}" as template
+// with given variables, so titles of generated pages are consistent. Titles
+// without actions are returned as is.
+func RenderTitle(
+	title string,
+	templates *template.Template,
+	vars map[string]interface{},
+) (string, error) {
+	if !strings.Contains(title, "{{") {
+		return title, nil
+	}
+
+	parsed, err := templates.New("title").
+		Option("missingkey=error").
+		Parse(title)
+	if err != nil {
+		return "", karma.Format(err, "unable to parse title %q", title)
+	}
+
+	var buffer bytes.Buffer
+
+	err = parsed.Execute(&buffer, vars)
+	if err != nil {
+		return "", karma.Format(err, "unable to execute title %q", title)
+	}
+
+	rendered := strings.Join(strings.Fields(buffer.String()), " ")
+	if rendered == "" {
+		return "", fmt.Errorf("title %q is rendered as empty string", title)
+	}
+
+	return rendered, nil
+}
@@ -0,0 +1,319 @@
+package mark
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTitleFromFilename(t *testing.T) {
+	test := assert.New(t)
+
+	title, err := TitleFromFilename(
+		"docs/getting-started.md",
+		[]string{"spaces", "title"},
+	)
+	test.NoError(err)
+	test.Equal("Getting Started", title)
+
+	title, err = TitleFromFilename("API_reference.md", []string{"spaces"})
+	test.NoError(err)
+	test.Equal("API reference", title)
+
+	_, err = TitleFromFilename("a.md", []string{"upper"})
+	test.Error(err)
+}
+
+func TestMeta_AddLabels(t *testing.T) {
+	meta := &Meta{Labels: []string{"a", "b"}}
+	meta.AddLabels("b", "c", "c")
+
+	assert.Equal(t, []string{"a", "b", "c"}, meta.Labels)
+}
+
+func TestExtractMeta_BlogPost(t *testing.T) {
+	test := assert.New(t)
+
+	meta, _, err := ExtractMeta([]byte(
+		"<!-- Space: TEST -->\n" +
+			"<!-- Type: blogpost -->\n" +
+			"<!-- Date: 2020-05-01 -->\n" +
+			"<!-- Title: News -->\n",
+	))
+	test.NoError(err)
+	test.Equal(TypeBlogPost, meta.Type)
+	test.Equal("2020-05-01", meta.Date)
+
+	meta.ApplyDefaults("TEST", "Parent")
+	test.Empty(meta.Parents)
+
+	_, _, err = ExtractMeta([]byte("<!-- Type: post -->\n"))
+	test.Error(err)
+
+	_, _, err = ExtractMeta([]byte("<!-- Date: 01.05.2020 -->\n"))
+	test.Error(err)
+}
+
+func TestExtractMeta_ThematicBreaks(t *testing.T) {
+	test := assert.New(t)
+
+	meta, markdown, err := ExtractMeta([]byte(
+		"---\n" +
+			"title: Release Notes\n" +
+			"space: TEST\n" +
+			"label: [release, notes]\n" +
+			"---\n" +
+			"first\n\n---\n\nsecond\n",
+	))
+	test.NoError(err)
+	test.Equal("Release Notes", meta.Title)
+	test.Equal("TEST", meta.Space)
+	test.Equal([]string{"release", "notes"}, meta.Labels)
+	test.Equal("first\n\n---\n\nsecond\n", string(markdown))
+
+	test.Equal(
+		"<p>first</p>\n\n<hr />\n\n<p>second</p>\n",
+		CompileMarkdown(markdown, nil, CompileOptions{}),
+	)
+
+	meta, markdown, err = ExtractMeta([]byte(
+		"<!-- Title: Release Notes -->\n---\n\nsecond\n",
+	))
+	test.NoError(err)
+	test.Equal("Release Notes", meta.Title)
+	test.Equal("---\n\nsecond\n", string(markdown))
+
+	meta, markdown, err = ExtractMeta([]byte("---\n\nno front matter\n"))
+	test.NoError(err)
+	test.Nil(meta)
+	test.Equal("---\n\nno front matter\n", string(markdown))
+
+	meta, markdown, err = ExtractMeta([]byte("---\nfirst\n\n---\nsecond\n"))
+	test.NoError(err)
+	test.Nil(meta)
+	test.Equal("---\nfirst\n\n---\nsecond\n", string(markdown))
+}
+
+func TestWriteBackHeaders(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		"<!-- Space: TEST -->\n"+
+			"<!-- Title: Page -->\n"+
+			"<!-- PageID: 123 -->\n"+
+			"<!-- Version: 3 -->\n"+
+			"<!-- URL: http://wiki/display/TEST/Page -->\n"+
+			"\n# Page\n",
+		string(WriteBackHeaders(
+			[]byte(
+				"<!-- Space: TEST -->\n"+
+					"<!-- PageID: 123 -->\n"+
+					"<!-- Version: 2 -->\n"+
+					"<!-- Title: Page -->\n"+
+					"\n# Page\n",
+			),
+			"123", 3, "http://wiki/display/TEST/Page",
+		)),
+	)
+
+	test.Equal(
+		"---\n"+
+			"title: Page\n"+
+			`PageID: "123"`+"\n"+
+			`Version: "3"`+"\n"+
+			`URL: "http://wiki/x"`+"\n"+
+			"---\n\n# Page\n",
+		string(WriteBackHeaders(
+			[]byte("---\ntitle: Page\nPageID: \"1\"\n---\n\n# Page\n"),
+			"123", 3, "http://wiki/x",
+		)),
+	)
+
+	test.Equal(
+		"<!-- PageID: 123 -->\n"+
+			"<!-- Version: 1 -->\n"+
+			"<!-- URL: http://wiki/x -->\n"+
+			"\n# Page\n",
+		string(WriteBackHeaders([]byte("# Page\n"), "123", 1, "http://wiki/x")),
+	)
+
+	meta, _, err := ExtractMeta(WriteBackHeaders(
+		[]byte("---\ntitle: Page\n---\n"), "123", 1, "http://wiki/x",
+	))
+	test.NoError(err)
+	test.Equal("123", meta.PageID)
+	test.Equal(int64(1), meta.Version)
+
+	_, _, err = ExtractMeta([]byte("<!-- Version: latest -->\n"))
+	test.Error(err)
+}
+
+func TestWriteBackHeaders_CaseInsensitive(t *testing.T) {
+	test := assert.New(t)
+
+	data := []byte(
+		"---\ntitle: Page\npageId: \"123\"\nversion: 2\n" +
+			"url: http://wiki/x\n---\n\n# Page\n",
+	)
+
+	meta, _, err := ExtractMeta(data)
+	test.NoError(err)
+	test.Equal("123", meta.PageID)
+	test.Equal(int64(2), meta.Version)
+
+	test.Equal(
+		"---\n"+
+			"title: Page\n"+
+			`PageID: "123"`+"\n"+
+			`Version: "3"`+"\n"+
+			`URL: "http://wiki/x"`+"\n"+
+			"---\n\n# Page\n",
+		string(WriteBackHeaders(data, "123", 3, "http://wiki/x")),
+	)
+
+	test.Equal(
+		"<!-- PageID: 123 -->\n"+
+			"<!-- Version: 3 -->\n"+
+			"<!-- URL: http://wiki/x -->\n"+
+			"\n# Page\n",
+		string(WriteBackHeaders(
+			[]byte("<!-- pageid: 1 -->\n<!-- VERSION: 2 -->\n\n# Page\n"),
+			"123", 3, "http://wiki/x",
+		)),
+	)
+}
+
+func TestExtractMeta_Watchers(t *testing.T) {
+	meta, _, err := ExtractMeta([]byte(
+		"---\nwatchers: [alice, bob]\n---\n<!-- Watchers: carol, dave -->\n",
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob", "carol", "dave"}, meta.Watchers)
+}
+
+func TestExtractMeta_AttachmentsDir(t *testing.T) {
+	meta, _, err := ExtractMeta([]byte("---\nattachmentsDir: assets\n---\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "assets", meta.AttachmentsDir)
+}
+
+func TestExtractMeta_Author(t *testing.T) {
+	meta, _, err := ExtractMeta([]byte(
+		"---\ntitle: Page\nauthor: alice\n---\n\n# Page\n",
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", meta.Author)
+}
+
+func TestExtractAttachmentHeaders(t *testing.T) {
+	paths, markdown := ExtractAttachmentHeaders([]byte(
+		"text\n" +
+			"<!-- Attachment: images/logo.png -->\n" +
+			"![logo](images/logo.png)\n" +
+			"```\n<!-- Attachment: code.png -->\n```\n" +
+			"  <!-- Attachment: diagrams/*.svg -->",
+	))
+
+	assert.Equal(t, []string{"images/logo.png", "diagrams/*.svg"}, paths)
+	assert.Equal(
+		t,
+		"text\n"+
+			"![logo](images/logo.png)\n"+
+			"```\n<!-- Attachment: code.png -->\n```\n",
+		string(markdown),
+	)
+}
+
+func TestExtractMeta_Status(t *testing.T) {
+	meta, _, err := ExtractMeta([]byte(
+		"<!-- Title: Page -->\n<!-- Status: archived -->\n",
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, StatusArchived, meta.Status)
+
+	_, _, err = ExtractMeta([]byte(
+		"<!-- Title: Page -->\n<!-- Status: deleted -->\n",
+	))
+	assert.Error(t, err)
+}
+
+func TestExtractMeta_OptionalAttachments(t *testing.T) {
+	test := assert.New(t)
+
+	meta, _, err := ExtractMeta([]byte(text(
+		"---",
+		"title: Page",
+		"attachments:",
+		"  - logo.png",
+		"  - path: screenshot.png",
+		"    optional: true",
+		"  - path: diagram.png",
+		"---",
+		"",
+		"text",
+	)))
+	test.NoError(err)
+	test.Equal(
+		map[string]string{
+			"logo.png":       "logo.png",
+			"screenshot.png": "screenshot.png",
+			"diagram.png":    "diagram.png",
+		},
+		meta.Attachments,
+	)
+	test.Equal(map[string]bool{"screenshot.png": true}, meta.OptionalAttachments)
+
+	meta, _, err = ExtractMeta([]byte("<!-- OptionalAttachment: a.png -->\n"))
+	test.NoError(err)
+	test.True(meta.OptionalAttachments["a.png"])
+
+	_, _, err = ExtractMeta([]byte(text(
+		"---",
+		"attachment:",
+		"  - optional: yes please",
+		"---",
+	)))
+	test.Error(err)
+}
+
+func TestExtractMeta_RenameFrom(t *testing.T) {
+	test := assert.New(t)
+
+	meta, _, err := ExtractMeta([]byte(
+		"---\ntitle: Setup\nrename_from: [Install, Installation]\n---\n" +
+			"<!-- RenameFrom: Getting Started -->\n",
+	))
+	test.NoError(err)
+	test.Equal(
+		[]string{"Install", "Installation", "Getting Started"},
+		meta.RenameFrom,
+	)
+}
+
+func TestRenderTitle(t *testing.T) {
+	test := assert.New(t)
+
+	templates := template.New("test")
+
+	title, err := RenderTitle(
+		"Weekly Status — {{ .week }} ({{ .Git.Branch }})",
+		templates,
+		map[string]interface{}{
+			"week": 42,
+			"Git":  Git{Branch: "main"},
+		},
+	)
+	test.NoError(err)
+	test.Equal("Weekly Status — 42 (main)", title)
+
+	title, err = RenderTitle("Plain {title}", templates, nil)
+	test.NoError(err)
+	test.Equal("Plain {title}", title)
+
+	_, err = RenderTitle("Status {{ .missing }}", templates, map[string]interface{}{})
+	test.Error(err)
+
+	_, err = RenderTitle("{{ .empty }}", templates, map[string]interface{}{"empty": ""})
+	test.Error(err)
+}
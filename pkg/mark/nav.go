@@ -0,0 +1,53 @@
+package mark
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+	"gopkg.in/yaml.v2"
+)
+
+// Nav maps document slugs to IDs of their parent pages. Slug is a path of
+// markdown file without extension, e.g. docs/setup/install for
+// docs/setup/install.md, or just its base name, e.g. install.
+type Nav map[string]string
+
+// LoadNav reads navigation index from specified YAML file.
+func LoadNav(path string) (Nav, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, karma.Format(err, "unable to read navigation index")
+	}
+
+	nav := Nav{}
+
+	err = yaml.Unmarshal(data, &nav)
+	if err != nil {
+		return nil, karma.Format(
+			err,
+			"unable to decode navigation index %q",
+			path,
+		)
+	}
+
+	return nav, nil
+}
+
+// Parent returns ID of parent page for specified file, full slug takes
+// precedence over base name.
+func (nav Nav) Parent(file string) (string, bool) {
+	slug := filepath.ToSlash(filepath.Clean(file))
+	slug = strings.TrimSuffix(slug, filepath.Ext(slug))
+
+	if id, ok := nav[slug]; ok && id != "" {
+		return id, true
+	}
+
+	if id, ok := nav[filepath.Base(slug)]; ok && id != "" {
+		return id, true
+	}
+
+	return "", false
+}
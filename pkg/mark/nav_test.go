@@ -0,0 +1,46 @@
+package mark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNavParent(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark-nav")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nav.yaml")
+
+	err = ioutil.WriteFile(
+		path,
+		[]byte("docs/setup/install: 100\ninstall: 200\nusage: \"300\"\n"),
+		0644,
+	)
+	test.NoError(err)
+
+	nav, err := LoadNav(path)
+	test.NoError(err)
+
+	id, ok := nav.Parent("docs/setup/install.md")
+	test.True(ok)
+	test.Equal("100", id)
+
+	id, ok = nav.Parent("other/install.md")
+	test.True(ok)
+	test.Equal("200", id)
+
+	id, ok = nav.Parent("./docs/usage.md")
+	test.True(ok)
+	test.Equal("300", id)
+
+	_, ok = nav.Parent("docs/faq.md")
+	test.False(ok)
+}
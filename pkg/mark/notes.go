@@ -0,0 +1,82 @@
+package mark
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// DefaultNoteMarkers are markers of comments like <!-- REVIEW: ... -->, which
+// are left by reviewers and never published.
+var DefaultNoteMarkers = []string{"REVIEW", "TODO", "FIXME"}
+
+type Note struct {
+	Line   int
+	Marker string
+	Text   string
+}
+
+// ExtractNotes removes comments starting with any of given markers like
+// <!-- TODO: add diagram --> from markdown and returns them along with line
+// numbers, so outstanding notes can be listed before publishing. Comments
+// placed on their own lines are removed along with these lines, comments
+// inside code are left as is.
+func ExtractNotes(markdown []byte, markers []string) ([]byte, []Note) {
+	if len(markers) == 0 {
+		return markdown, nil
+	}
+
+	quoted := []string{}
+	for _, marker := range markers {
+		quoted = append(quoted, regexp.QuoteMeta(marker))
+	}
+
+	reNote := regexp.MustCompile(
+		`(?s)<!--\s*(` + strings.Join(quoted, "|") + `)\b:?\s*(.*?)\s*-->`,
+	)
+
+	var (
+		notes  = []Note{}
+		buffer bytes.Buffer
+		last   = 0
+		code   = codeRanges(markdown)
+	)
+
+	for _, match := range reNote.FindAllSubmatchIndex(markdown, -1) {
+		start, end := match[0], match[1]
+		if insideRanges(code, start) {
+			continue
+		}
+
+		notes = append(notes, Note{
+			Line:   bytes.Count(markdown[:start], []byte("\n")) + 1,
+			Marker: string(markdown[match[2]:match[3]]),
+			Text:   string(markdown[match[4]:match[5]]),
+		})
+
+		// comment on its own line is removed along with the line, so it
+		// doesn't split paragraph
+		lineStart := bytes.LastIndexByte(markdown[:start], '\n') + 1
+
+		lineEnd := bytes.IndexByte(markdown[end:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(markdown)
+		} else {
+			lineEnd += end + 1
+		}
+
+		if lineStart >= last &&
+			len(bytes.TrimSpace(markdown[lineStart:start])) == 0 &&
+			len(bytes.TrimSpace(markdown[end:lineEnd])) == 0 {
+			start, end = lineStart, lineEnd
+		}
+
+		buffer.Write(markdown[last:start])
+
+		last = end
+	}
+
+	buffer.Write(markdown[last:])
+
+	return buffer.Bytes(), notes
+}
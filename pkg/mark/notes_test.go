@@ -0,0 +1,69 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractNotes(t *testing.T) {
+	test := assert.New(t)
+
+	markdown, notes := ExtractNotes(
+		[]byte(text(
+			"# Title",
+			"",
+			"First line",
+			"<!-- REVIEW: is this still true? -->",
+			"second line.",
+			"",
+			"Text <!-- TODO add diagram --> inline.",
+			"",
+			"<!-- Regular comment -->",
+			"",
+			"```",
+			"<!-- FIXME: example -->",
+			"```",
+			"",
+			"<!--",
+			"  FIXME: split",
+			"  this section",
+			"-->",
+			"End",
+		)),
+		DefaultNoteMarkers,
+	)
+
+	test.Equal(
+		text(
+			"# Title",
+			"",
+			"First line",
+			"second line.",
+			"",
+			"Text  inline.",
+			"",
+			"<!-- Regular comment -->",
+			"",
+			"```",
+			"<!-- FIXME: example -->",
+			"```",
+			"",
+			"End",
+		),
+		string(markdown),
+	)
+
+	test.Equal(
+		[]Note{
+			{Line: 4, Marker: "REVIEW", Text: "is this still true?"},
+			{Line: 7, Marker: "TODO", Text: "add diagram"},
+			{Line: 15, Marker: "FIXME", Text: "split\n  this section"},
+		},
+		notes,
+	)
+
+	markdown, notes = ExtractNotes([]byte("<!-- TODO: keep -->\n"), nil)
+	test.Equal("<!-- TODO: keep -->\n", string(markdown))
+	test.Empty(notes)
+}
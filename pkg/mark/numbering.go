@@ -0,0 +1,41 @@
+package mark
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// renderHeadingNumber renders opening tag of given heading followed by its
+// hierarchical number like 1.2.3, headings above HeadingNumbers level are not
+// numbered. Returns false if heading is not numbered.
+func (renderer ConfluenceRenderer) renderHeadingNumber(
+	writer io.Writer,
+	node *bf.Node,
+) bool {
+	level := node.HeadingData.Level
+	if node.HeadingData.IsTitleblock || level < renderer.HeadingNumbers {
+		return false
+	}
+
+	depth := level - renderer.HeadingNumbers
+
+	renderer.numbers[depth]++
+	for i := depth + 1; i < len(renderer.numbers); i++ {
+		renderer.numbers[i] = 0
+	}
+
+	numbers := []string{}
+	for _, number := range renderer.numbers[:depth+1] {
+		numbers = append(numbers, strconv.Itoa(number))
+	}
+
+	renderer.Renderer.RenderNode(writer, node, true)
+
+	fmt.Fprintf(writer, "%s ", strings.Join(numbers, "."))
+
+	return true
+}
@@ -0,0 +1,119 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// attributionPrefixes start attribution line of blockquote like
+// "> — Author, Source".
+var attributionPrefixes = [][]byte{
+	[]byte("— "),
+	[]byte("― "),
+	[]byte("-- "),
+}
+
+// parseAttribution checks that last line of given blockquote is attribution
+// and, if so, moves it into separate paragraph and remembers it for later
+// rendering as citation. Blockquotes consisting only of attribution are left
+// as is.
+func (renderer ConfluenceRenderer) parseAttribution(quote *bf.Node) {
+	paragraph := quote.LastChild
+	if paragraph == nil || paragraph.Type != bf.Paragraph {
+		return
+	}
+
+	var (
+		text   *bf.Node
+		offset int
+	)
+
+	for child := paragraph.FirstChild; child != nil; child = child.Next {
+		if child.Type != bf.Text {
+			continue
+		}
+
+		for _, line := range attributionLines(child.Literal) {
+			if line == 0 && child != paragraph.FirstChild {
+				continue
+			}
+
+			text, offset = child, line
+		}
+	}
+
+	if text == nil {
+		return
+	}
+
+	if text == paragraph.FirstChild && offset == 0 {
+		if paragraph == quote.FirstChild {
+			return
+		}
+
+		renderer.attributions[paragraph] = true
+
+		return
+	}
+
+	attribution := bf.NewNode(bf.Paragraph)
+
+	tail := bf.NewNode(bf.Text)
+	tail.Literal = text.Literal[offset:]
+	attribution.AppendChild(tail)
+
+	for sibling := text.Next; sibling != nil; {
+		next := sibling.Next
+
+		sibling.Unlink()
+		attribution.AppendChild(sibling)
+
+		sibling = next
+	}
+
+	text.Literal = bytes.TrimRight(text.Literal[:offset], "\n")
+
+	quote.AppendChild(attribution)
+
+	renderer.attributions[attribution] = true
+}
+
+// attributionLines returns offsets of lines of given text which start with
+// attribution prefix.
+func attributionLines(text []byte) []int {
+	offsets := []int{}
+
+	for offset := 0; offset < len(text); {
+		for _, prefix := range attributionPrefixes {
+			if bytes.HasPrefix(text[offset:], prefix) {
+				offsets = append(offsets, offset)
+
+				break
+			}
+		}
+
+		next := bytes.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			break
+		}
+
+		offset += next + 1
+	}
+
+	return offsets
+}
+
+// renderAttribution renders attribution paragraph as citation.
+func (renderer ConfluenceRenderer) renderAttribution(
+	writer io.Writer,
+	entering bool,
+) {
+	if entering {
+		fmt.Fprint(writer, "<p><cite>")
+	} else {
+		fmt.Fprint(writer, "</cite></p>\n")
+	}
+}
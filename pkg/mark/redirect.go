@@ -0,0 +1,37 @@
+package mark
+
+import (
+	"fmt"
+	"html"
+)
+
+// RedirectProperty is a key of content property, which holds ID of the page
+// redirect page created from RenameFrom header points to, so only such pages
+// are updated and pages created manually are never overwritten.
+const RedirectProperty = "mark-redirect"
+
+// RenderRedirect renders contents of the page, which is left at previous
+// title of renamed page and points to the page with given title. If macro is
+// true, redirect macro, which is provided by third-party app, is added as
+// well to send visitors to the new page automatically.
+func RenderRedirect(space string, title string, macro bool) string {
+	link := fmt.Sprintf(
+		`<ac:link><ri:page ri:space-key="%s" ri:content-title="%s" /></ac:link>`,
+		html.EscapeString(space),
+		html.EscapeString(title),
+	)
+
+	contents := fmt.Sprintf("<p>This page has been moved to %s.</p>\n", link)
+
+	if macro {
+		contents = fmt.Sprintf(
+			`<ac:structured-macro ac:name="redirect">`+
+				`<ac:parameter ac:name="location">%s</ac:parameter>`+
+				"</ac:structured-macro>\n%s",
+			link,
+			contents,
+		)
+	}
+
+	return contents
+}
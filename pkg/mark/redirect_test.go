@@ -0,0 +1,29 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderRedirect(t *testing.T) {
+	test := assert.New(t)
+
+	test.Equal(
+		`<p>This page has been moved to <ac:link>`+
+			`<ri:page ri:space-key="DOC" ri:content-title="Q&amp;A" />`+
+			"</ac:link>.</p>\n",
+		RenderRedirect("DOC", "Q&A", false),
+	)
+
+	test.Equal(
+		`<ac:structured-macro ac:name="redirect">`+
+			`<ac:parameter ac:name="location"><ac:link>`+
+			`<ri:page ri:space-key="DOC" ri:content-title="Setup" />`+
+			"</ac:link></ac:parameter></ac:structured-macro>\n"+
+			`<p>This page has been moved to <ac:link>`+
+			`<ri:page ri:space-key="DOC" ri:content-title="Setup" />`+
+			"</ac:link>.</p>\n",
+		RenderRedirect("DOC", "Setup", true),
+	)
+}
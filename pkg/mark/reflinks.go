@@ -0,0 +1,128 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// [label]: url "title"
+	reLinkDefinition = regexp.MustCompile(
+		`(?m)^ {0,3}\[([^\]]+)\]:[ \t]*<?([^\s>]+)>?` +
+			`(?:[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?[ \t]*(?:\n|$)`,
+	)
+
+	// ![text][label], [text][label], [text][] or [label]
+	reReferenceLink = regexp.MustCompile(`(!?)\[([^\]]*)\](?:\[([^\]]*)\])?`)
+)
+
+type linkDefinition struct {
+	url   string
+	title string
+}
+
+// InlineReferenceLinks converts reference-style links and images like
+// [text][label] into inline ones like [text](url), so they are handled by
+// link and attachment resolving in the same way. Link definitions are
+// removed, references to undefined labels are left as is.
+func InlineReferenceLinks(markdown []byte) []byte {
+	code := codeRanges(markdown)
+
+	definitions := map[string]linkDefinition{}
+
+	var buffer bytes.Buffer
+
+	last := 0
+	for _, match := range reLinkDefinition.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		label := normalizeLinkLabel(string(markdown[match[2]:match[3]]))
+
+		definition := linkDefinition{
+			url: string(markdown[match[4]:match[5]]),
+		}
+
+		for group := 3; group <= 5; group++ {
+			if match[group*2] >= 0 {
+				definition.title = string(
+					markdown[match[group*2]:match[group*2+1]],
+				)
+			}
+		}
+
+		// first definition takes precedence
+		if _, ok := definitions[label]; !ok {
+			definitions[label] = definition
+		}
+
+		buffer.Write(markdown[last:match[0]])
+
+		last = match[1]
+	}
+
+	if len(definitions) == 0 {
+		return markdown
+	}
+
+	buffer.Write(markdown[last:])
+
+	markdown = buffer.Bytes()
+	code = codeRanges(markdown)
+
+	var result bytes.Buffer
+
+	last = 0
+	for _, match := range reReferenceLink.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, match[0]) {
+			continue
+		}
+
+		// inline link like [text](url)
+		inline := match[1] < len(markdown) && markdown[match[1]] == '('
+		if match[6] < 0 && inline {
+			continue
+		}
+
+		text := string(markdown[match[4]:match[5]])
+
+		label := text
+		if match[6] >= 0 && match[7] > match[6] {
+			label = string(markdown[match[6]:match[7]])
+		}
+
+		definition, ok := definitions[normalizeLinkLabel(label)]
+		if !ok {
+			continue
+		}
+
+		link := strings.ReplaceAll(definition.url, " ", "%20")
+		if definition.title != "" {
+			link += fmt.Sprintf(" %q", definition.title)
+		}
+
+		result.Write(markdown[last:match[0]])
+		fmt.Fprintf(
+			&result,
+			"%s[%s](%s)",
+			markdown[match[2]:match[3]],
+			text,
+			link,
+		)
+
+		last = match[1]
+	}
+
+	result.Write(markdown[last:])
+
+	return result.Bytes()
+}
+
+// normalizeLinkLabel makes labels matched case-insensitively and regardless
+// of whitespace.
+func normalizeLinkLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
@@ -0,0 +1,44 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInlineReferenceLinks(t *testing.T) {
+	test := assert.New(t)
+
+	markdown := InlineReferenceLinks([]byte(text(
+		"See [setup][Setup Guide], [faq][] and [FAQ].",
+		"",
+		"![diagram][img] [inline](other.md) [undefined][nope]",
+		"",
+		"`[faq]`",
+		"",
+		"[setup guide]: ./setup.md",
+		"  [faq]: <faq.md> \"Questions\"",
+		"[img]: images/diagram.png",
+		"",
+	)))
+
+	test.Equal(
+		text(
+			"See [setup](./setup.md), [faq](faq.md \"Questions\") and "+
+				"[FAQ](faq.md \"Questions\").",
+			"",
+			"![diagram](images/diagram.png) [inline](other.md) "+
+				"[undefined][nope]",
+			"",
+			"`[faq]`",
+			"",
+			"",
+		),
+		string(markdown),
+	)
+
+	test.Equal(
+		"[text] without definitions",
+		string(InlineReferenceLinks([]byte("[text] without definitions"))),
+	)
+}
@@ -0,0 +1,103 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/reconquest/karma-go"
+)
+
+// Replacement is a find/replace rule applied to markdown before compiling.
+type Replacement struct {
+	// Find is a literal text or regular expression if Regexp is set.
+	Find string `toml:"find"`
+
+	// Replace is a replacement text, which can reference submatches like $1
+	// if Regexp is set.
+	Replace string `toml:"replace"`
+
+	Regexp bool `toml:"regexp"`
+
+	// SkipCode leaves code blocks and inline code as is.
+	SkipCode bool `toml:"skip_code"`
+}
+
+// Replacer is a transformer applying replacements in order.
+type Replacer struct {
+	replacements []Replacement
+	patterns     []*regexp.Regexp
+}
+
+// NewReplacer returns transformer applying given replacements in order.
+func NewReplacer(replacements []Replacement) (*Replacer, error) {
+	replacer := &Replacer{replacements: replacements}
+
+	for _, replacement := range replacements {
+		if replacement.Find == "" {
+			return nil, fmt.Errorf(
+				"replacement with %q doesn't specify text to find",
+				replacement.Replace,
+			)
+		}
+
+		var pattern *regexp.Regexp
+
+		if replacement.Regexp {
+			var err error
+
+			pattern, err = regexp.Compile(replacement.Find)
+			if err != nil {
+				return nil, karma.Format(
+					err,
+					"unable to compile replacement pattern %q",
+					replacement.Find,
+				)
+			}
+		}
+
+		replacer.patterns = append(replacer.patterns, pattern)
+	}
+
+	return replacer, nil
+}
+
+func (replacer *Replacer) Transform(markdown []byte) ([]byte, error) {
+	for i, replacement := range replacer.replacements {
+		replace := func(text []byte) []byte {
+			if pattern := replacer.patterns[i]; pattern != nil {
+				return pattern.ReplaceAll(text, []byte(replacement.Replace))
+			}
+
+			return bytes.ReplaceAll(
+				text,
+				[]byte(replacement.Find),
+				[]byte(replacement.Replace),
+			)
+		}
+
+		if !replacement.SkipCode {
+			markdown = replace(markdown)
+
+			continue
+		}
+
+		var (
+			buffer bytes.Buffer
+			offset int
+		)
+
+		for _, code := range codeRanges(markdown) {
+			buffer.Write(replace(markdown[offset:code[0]]))
+			buffer.Write(markdown[code[0]:code[1]])
+
+			offset = code[1]
+		}
+
+		buffer.Write(replace(markdown[offset:]))
+
+		markdown = buffer.Bytes()
+	}
+
+	return markdown, nil
+}
@@ -0,0 +1,44 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplacer(t *testing.T) {
+	test := assert.New(t)
+
+	replacer, err := NewReplacer([]Replacement{
+		{Find: "OldName", Replace: "NewName"},
+		{Find: `\bNewName\b(\(TM\))?`, Replace: "NewName™", Regexp: true, SkipCode: true},
+	})
+	test.NoError(err)
+
+	markdown, err := replacer.Transform([]byte(text(
+		"OldName(TM) is `OldName`.",
+		"",
+		"```",
+		"OldName",
+		"```",
+		"",
+	)))
+	test.NoError(err)
+	test.Equal(
+		text(
+			"NewName™ is `NewName`.",
+			"",
+			"```",
+			"NewName",
+			"```",
+			"",
+		),
+		string(markdown),
+	)
+
+	_, err = NewReplacer([]Replacement{{Find: "(", Regexp: true}})
+	test.Error(err)
+
+	_, err = NewReplacer([]Replacement{{Replace: "text"}})
+	test.Error(err)
+}
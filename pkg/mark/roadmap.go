@@ -0,0 +1,325 @@
+package mark
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/reconquest/karma-go"
+	"gopkg.in/yaml.v2"
+)
+
+var reRoadmapBlock = regexp.MustCompile("(?ms)^```roadmap[ \\t]*\\n(.*?)^```[ \\t]*$")
+
+const (
+	roadmapDateLayout   = "2006-01-02"
+	roadmapSourceLayout = "2006-01-02 15:04:05"
+)
+
+type roadmapColor struct {
+	Lane  string `json:"lane"`
+	Bar   string `json:"bar"`
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// colors used by Confluence for lanes by default
+var roadmapColors = []roadmapColor{
+	{Lane: "#f6c342", Bar: "#fadb8e", Text: "#594300", Count: 1},
+	{Lane: "#3b7fc4", Bar: "#6c9fd6", Text: "#ffffff", Count: 1},
+	{Lane: "#14892c", Bar: "#5bb26d", Text: "#ffffff", Count: 1},
+	{Lane: "#d04437", Bar: "#de7b72", Text: "#ffffff", Count: 1},
+	{Lane: "#654982", Bar: "#9480aa", Text: "#ffffff", Count: 1},
+}
+
+// Roadmap is YAML representation of roadmap planner macro:
+//
+//	title: Q1 Plan
+//	start: 2024-01-01
+//	end: 2024-06-30
+//	lanes:
+//	  - title: Backend
+//	    bars:
+//	      - title: API
+//	        start: 2024-01-01
+//	        duration: 2
+//	markers:
+//	  - title: Release
+//	    date: 2024-03-01
+type Roadmap struct {
+	Title   string          `yaml:"title"`
+	Start   string          `yaml:"start"`
+	End     string          `yaml:"end"`
+	Lanes   []RoadmapLane   `yaml:"lanes"`
+	Markers []RoadmapMarker `yaml:"markers"`
+}
+
+type RoadmapLane struct {
+	Title string       `yaml:"title"`
+	Color string       `yaml:"color"`
+	Bars  []RoadmapBar `yaml:"bars"`
+}
+
+type RoadmapBar struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Start       string `yaml:"start"`
+
+	// Duration is specified in months.
+	Duration float64 `yaml:"duration"`
+
+	// Row is zero-based row inside the lane.
+	Row int `yaml:"row"`
+}
+
+type RoadmapMarker struct {
+	Title string `yaml:"title"`
+	Date  string `yaml:"date"`
+}
+
+// CompileRoadmaps replaces ```roadmap code blocks containing YAML roadmap
+// definition with Confluence roadmap planner macro.
+func CompileRoadmaps(markdown []byte) ([]byte, error) {
+	var err error
+
+	markdown = reRoadmapBlock.ReplaceAllFunc(
+		markdown,
+		func(block []byte) []byte {
+			if err != nil {
+				return block
+			}
+
+			var macro string
+
+			macro, err = compileRoadmap(
+				reRoadmapBlock.FindSubmatch(block)[1],
+			)
+			if err != nil {
+				return block
+			}
+
+			return []byte(macro)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return markdown, nil
+}
+
+func compileRoadmap(data []byte) (string, error) {
+	var roadmap Roadmap
+
+	err := yaml.UnmarshalStrict(data, &roadmap)
+	if err != nil {
+		return "", karma.Format(err, "unable to decode roadmap")
+	}
+
+	source, err := roadmap.source()
+	if err != nil {
+		return "", karma.
+			Describe("roadmap", roadmap.Title).
+			Format(err, "invalid roadmap")
+	}
+
+	encoded := strings.ReplaceAll(url.QueryEscape(string(source)), "+", "%20")
+	hash := md5.Sum([]byte(encoded))
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString(`<ac:structured-macro ac:name="roadmap">`)
+
+	for _, param := range [][2]string{
+		{"source", encoded},
+		{"title", html.EscapeString(roadmap.Title)},
+		{"timeline", "true"},
+		{"hash", hex.EncodeToString(hash[:])},
+	} {
+		fmt.Fprintf(
+			&buffer,
+			`<ac:parameter ac:name="%s">%s</ac:parameter>`,
+			param[0],
+			param[1],
+		)
+	}
+
+	buffer.WriteString(`</ac:structured-macro>`)
+
+	return buffer.String(), nil
+}
+
+// source returns roadmap in JSON format used by roadmap planner macro.
+func (roadmap Roadmap) source() ([]byte, error) {
+	if roadmap.Title == "" {
+		roadmap.Title = "Roadmap Planner"
+	}
+
+	start, err := parseRoadmapDate("start", roadmap.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseRoadmapDate("end", roadmap.End)
+	if err != nil {
+		return nil, err
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf(
+			"end date %s is before start date %s",
+			roadmap.End,
+			roadmap.Start,
+		)
+	}
+
+	type bar struct {
+		Title       string      `json:"title"`
+		Description string      `json:"description"`
+		StartDate   string      `json:"startDate"`
+		Duration    float64     `json:"duration"`
+		RowIndex    int         `json:"rowIndex"`
+		ID          string      `json:"id"`
+		PageLink    interface{} `json:"pageLink"`
+	}
+
+	type lane struct {
+		Title string       `json:"title"`
+		Color roadmapColor `json:"color"`
+		Bars  []bar        `json:"bars"`
+	}
+
+	type marker struct {
+		Title      string `json:"title"`
+		MarkerDate string `json:"markerDate"`
+	}
+
+	source := struct {
+		Title    string `json:"title"`
+		Timeline struct {
+			StartDate     string `json:"startDate"`
+			EndDate       string `json:"endDate"`
+			DisplayOption string `json:"displayOption"`
+		} `json:"timeline"`
+		Lanes   []lane   `json:"lanes"`
+		Markers []marker `json:"markers"`
+	}{
+		Title:   roadmap.Title,
+		Lanes:   []lane{},
+		Markers: []marker{},
+	}
+
+	source.Timeline.StartDate = start.Format(roadmapSourceLayout)
+	source.Timeline.EndDate = end.Format(roadmapSourceLayout)
+	source.Timeline.DisplayOption = "MONTH"
+
+	if len(roadmap.Lanes) == 0 {
+		return nil, fmt.Errorf("roadmap should contain at least one lane")
+	}
+
+	for i, item := range roadmap.Lanes {
+		facts := karma.Describe("lane", i+1)
+
+		if item.Title == "" {
+			return nil, facts.Format(nil, "lane title is not set")
+		}
+
+		color := roadmapColors[i%len(roadmapColors)]
+		if item.Color != "" {
+			color.Lane = item.Color
+			color.Bar = item.Color
+		}
+
+		result := lane{
+			Title: item.Title,
+			Color: color,
+			Bars:  []bar{},
+		}
+
+		for j, itemBar := range item.Bars {
+			facts := facts.Describe("bar", j+1)
+
+			if itemBar.Title == "" {
+				return nil, facts.Format(nil, "bar title is not set")
+			}
+
+			if itemBar.Duration <= 0 {
+				return nil, facts.Format(nil, "bar duration should be positive")
+			}
+
+			if itemBar.Row < 0 {
+				return nil, facts.Format(nil, "bar row should not be negative")
+			}
+
+			date, err := parseRoadmapDate("start", itemBar.Start)
+			if err != nil {
+				return nil, facts.Format(err, "invalid bar")
+			}
+
+			id := md5.Sum([]byte(fmt.Sprintf("%d/%d/%s", i, j, itemBar.Title)))
+
+			result.Bars = append(result.Bars, bar{
+				Title:       itemBar.Title,
+				Description: itemBar.Description,
+				StartDate:   date.Format(roadmapSourceLayout),
+				Duration:    itemBar.Duration,
+				RowIndex:    itemBar.Row,
+				ID:          formatUUID(id[:]),
+				PageLink:    map[string]interface{}{},
+			})
+		}
+
+		source.Lanes = append(source.Lanes, result)
+	}
+
+	for i, item := range roadmap.Markers {
+		facts := karma.Describe("marker", i+1)
+
+		if item.Title == "" {
+			return nil, facts.Format(nil, "marker title is not set")
+		}
+
+		date, err := parseRoadmapDate("date", item.Date)
+		if err != nil {
+			return nil, facts.Format(err, "invalid marker")
+		}
+
+		source.Markers = append(source.Markers, marker{
+			Title:      item.Title,
+			MarkerDate: date.Format(roadmapSourceLayout),
+		})
+	}
+
+	return json.Marshal(source)
+}
+
+func parseRoadmapDate(field string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%s date is not set", field)
+	}
+
+	date, err := time.Parse(roadmapDateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"%s date %q should be in YYYY-MM-DD format",
+			field,
+			value,
+		)
+	}
+
+	return date, nil
+}
+
+func formatUUID(data []byte) string {
+	id := hex.EncodeToString(data)
+
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" +
+		id[16:20] + "-" + id[20:32]
+}
@@ -0,0 +1,52 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileRoadmaps(t *testing.T) {
+	test := assert.New(t)
+
+	markdown, err := CompileRoadmaps([]byte(text(
+		"```roadmap",
+		"title: Plan",
+		"start: 2024-01-01",
+		"end: 2024-06-30",
+		"lanes:",
+		"  - title: Backend",
+		"    bars:",
+		"      - title: API",
+		"        start: 2024-01-01",
+		"        duration: 2",
+		"```",
+	)))
+	test.NoError(err)
+	test.Contains(string(markdown), `<ac:structured-macro ac:name="roadmap">`)
+	test.Contains(
+		string(markdown),
+		`<ac:parameter ac:name="title">Plan</ac:parameter>`,
+	)
+
+	_, err = CompileRoadmaps([]byte(text(
+		"```roadmap",
+		"start: 2024-01-01",
+		"end: 2024-06-30",
+		"lanes:",
+		"  - title: Backend",
+		"    bars:",
+		"      - title: API",
+		"        start: 01/01/2024",
+		"        duration: 2",
+		"```",
+	)))
+	test.Error(err)
+
+	_, err = CompileRoadmaps([]byte(text(
+		"```roadmap",
+		"lanes: [",
+		"```",
+	)))
+	test.Error(err)
+}
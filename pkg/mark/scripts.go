@@ -0,0 +1,70 @@
+package mark
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// reScript matches Pandoc-style subscript like H~2~O and superscript like
+// x^2^, which can't contain unescaped spaces.
+var reScript = regexp.MustCompile(`~((?:[^~\s\\]|\\.)+)~|\^((?:[^\^\s\\]|\\.)+)\^`)
+
+var reScriptEscape = regexp.MustCompile(`\\(.)`)
+
+// renderScripts renders text node replacing subscript and superscript with
+// <sub> and <sup> elements. It returns false if text node doesn't contain
+// any of them.
+func (renderer ConfluenceRenderer) renderScripts(
+	writer io.Writer,
+	node *bf.Node,
+) bool {
+	text := node.Literal
+
+	matches := reScript.FindAllSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return false
+	}
+
+	plain := func(literal []byte) {
+		if len(literal) == 0 {
+			return
+		}
+
+		// text is rendered by renderer itself, so mentions are still
+		// rendered as well
+		renderer.RenderNode(
+			writer,
+			&bf.Node{
+				Type:    bf.Text,
+				Parent:  node.Parent,
+				Literal: literal,
+			},
+			true,
+		)
+	}
+
+	offset := 0
+	for _, match := range matches {
+		plain(text[offset:match[0]])
+
+		tag, group := "sub", match[2:4]
+		if group[0] < 0 {
+			tag, group = "sup", match[4:6]
+		}
+
+		literal := text[group[0]:group[1]]
+
+		fmt.Fprintf(writer, "<%s>", tag)
+		plain(reScriptEscape.ReplaceAll(literal, []byte(`$1`)))
+		fmt.Fprintf(writer, "</%s>", tag)
+
+		offset = match[1]
+	}
+
+	plain(text[offset:])
+
+	return true
+}
@@ -0,0 +1,50 @@
+package mark
+
+import (
+	"fmt"
+)
+
+// DefaultPageSizeLimit is a default limit of page body size in storage
+// format, bodies exceeding it are rejected by Confluence.
+const DefaultPageSizeLimit = 5 * 1024 * 1024
+
+// CheckPageSize returns error if size of compiled page body exceeds 90% of
+// given limit, so page can be split before Confluence rejects it.
+func CheckPageSize(html string, limit int) error {
+	if limit <= 0 {
+		limit = DefaultPageSizeLimit
+	}
+
+	if len(html) <= limit/10*9 {
+		return nil
+	}
+
+	if len(html) > limit {
+		return fmt.Errorf(
+			"page body is %s, which exceeds limit of %s, "+
+				"consider splitting the page",
+			formatSize(len(html)),
+			formatSize(limit),
+		)
+	}
+
+	return fmt.Errorf(
+		"page body is %s, which is close to limit of %s, "+
+			"consider splitting the page",
+		formatSize(len(html)),
+		formatSize(limit),
+	)
+}
+
+func formatSize(size int) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MiB", float64(size)/1024/1024)
+
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KiB", float64(size)/1024)
+
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
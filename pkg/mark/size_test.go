@@ -0,0 +1,32 @@
+package mark
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPageSize(t *testing.T) {
+	test := assert.New(t)
+
+	test.NoError(CheckPageSize(strings.Repeat("a", 900), 1000))
+
+	err := CheckPageSize(strings.Repeat("a", 901), 1000)
+	test.Error(err)
+	test.Equal(
+		"page body is 901 bytes, which is close to limit of 1000 bytes, "+
+			"consider splitting the page",
+		err.Error(),
+	)
+
+	err = CheckPageSize(strings.Repeat("a", 2048), 1024)
+	test.Error(err)
+	test.Equal(
+		"page body is 2.0 KiB, which exceeds limit of 1.0 KiB, "+
+			"consider splitting the page",
+		err.Error(),
+	)
+
+	test.NoError(CheckPageSize("<p>text</p>", 0))
+}
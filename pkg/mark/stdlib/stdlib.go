@@ -3,6 +3,7 @@ package stdlib
 import (
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/kovetskiy/mark/pkg/confluence"
 	"github.com/kovetskiy/mark/pkg/mark/macro"
@@ -63,6 +64,8 @@ func templates(api *confluence.API) (*template.Template, error) {
 		return strings.Join(line, ``)
 	}
 
+	usernames := map[string]*confluence.User{}
+
 	templates := template.New(`stdlib`).Funcs(
 		template.FuncMap{
 			"user": func(name string) *confluence.User {
@@ -74,6 +77,37 @@ func templates(api *confluence.API) (*template.Template, error) {
 				return user
 			},
 
+			"username": func(username string) *confluence.User {
+				if user, ok := usernames[username]; ok {
+					return user
+				}
+
+				user, err := api.GetUserByUsername(username)
+				if err != nil {
+					log.Error(err)
+				}
+
+				if user == nil && err == nil {
+					log.Warningf(
+						nil,
+						"user %q is not found, mention is left as plain text",
+						username,
+					)
+				}
+
+				usernames[username] = user
+
+				return user
+			},
+
+			"now": time.Now,
+
+			// Used as {{ now | date "2006-01-02" }}, layout is specified in
+			// Go format.
+			"date": func(layout string, value time.Time) string {
+				return value.Format(layout)
+			},
+
 			// The only way to escape CDATA end marker ']]>' is to split it
 			// into two CDATA sections.
 			"cdata": func(data string) string {
@@ -112,6 +146,23 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`<ac:structured-macro ac:name="code">{{printf "\n"}}`,
 			/**/ `<ac:parameter ac:name="language">{{ .Language }}</ac:parameter>{{printf "\n"}}`,
 			/**/ `<ac:parameter ac:name="collapse">{{ .Collapse }}</ac:parameter>{{printf "\n"}}`,
+			/**/ `{{ if .Theme }}<ac:parameter ac:name="theme">{{ .Theme }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			/**/ `{{ if .Title }}<ac:parameter ac:name="title">{{ .Title }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			/**/ `<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+
+			`{{ if .Collapse }}</ac:rich-text-body>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}{{ end }}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/noformat-macro-139545.html */
+
+		`ac:noformat`: text(
+			`{{ if .Collapse }}<ac:structured-macro ac:name="expand">{{printf "\n"}}`,
+			`{{ if .Title }}<ac:parameter ac:name="title">{{ .Title }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`<ac:rich-text-body>{{printf "\n"}}{{ end }}`,
+
+			`<ac:structured-macro ac:name="noformat">{{printf "\n"}}`,
 			/**/ `{{ if .Title }}<ac:parameter ac:name="title">{{ .Title }}</ac:parameter>{{printf "\n"}}{{ end }}`,
 			/**/ `<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>{{printf "\n"}}`,
 			`</ac:structured-macro>{{printf "\n"}}`,
@@ -120,6 +171,34 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`</ac:structured-macro>{{printf "\n"}}{{ end }}`,
 		),
 
+		/* https://confluence.atlassian.com/doc/html-macro-38273085.html */
+
+		`ac:html`: text(
+			`<ac:structured-macro ac:name="html">{{printf "\n"}}`,
+			`<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/iframe-macro-1044061829.html */
+
+		`ac:iframe`: text(
+			`<ac:structured-macro ac:name="iframe">{{printf "\n"}}`,
+			`<ac:parameter ac:name="src"><ri:url ri:value="{{ .URL }}" /></ac:parameter>{{printf "\n"}}`,
+			`{{ if .Width }}<ac:parameter ac:name="width">{{ .Width }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Height }}<ac:parameter ac:name="height">{{ .Height }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/widget-connector-macro-171180449.html */
+
+		`ac:widget`: text(
+			`<ac:structured-macro ac:name="widget">{{printf "\n"}}`,
+			`<ac:parameter ac:name="url"><ri:url ri:value="{{ .URL }}" /></ac:parameter>{{printf "\n"}}`,
+			`{{ if .Width }}<ac:parameter ac:name="width">{{ .Width }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Height }}<ac:parameter ac:name="height">{{ .Height }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
 		`ac:status`: text(
 			`<ac:structured-macro ac:name="status">`,
 			`<ac:parameter ac:name="colour">{{ or .Color "Grey" }}</ac:parameter>`,
@@ -130,14 +209,32 @@ func templates(api *confluence.API) (*template.Template, error) {
 
 		`ac:link:user`: text(
 			`{{ with .Name | user }}`,
-			/**/ `<ac:link>`,
-			/**/ `<ri:user ri:account-id="{{ .AccountID }}"/>`,
-			/**/ `</ac:link>`,
+			/**/ `{{ template "ac:link:user:ref" . }}`,
 			`{{ else }}`,
 			/**/ `{{ .Name }}`,
 			`{{ end }}`,
 		),
 
+		`ac:link:username`: text(
+			`{{ with .Name | username }}`,
+			/**/ `{{ template "ac:link:user:ref" . }}`,
+			`{{ else }}`,
+			/**/ `@{{ .Name }}`,
+			`{{ end }}`,
+		),
+
+		// Cloud instances identify users by account id, while server ones
+		// use user key.
+		`ac:link:user:ref`: text(
+			`<ac:link>`,
+			`{{ if .AccountID }}`,
+			/**/ `<ri:user ri:account-id="{{ .AccountID }}"/>`,
+			`{{ else }}`,
+			/**/ `<ri:user ri:userkey="{{ .UserKey }}"/>`,
+			`{{ end }}`,
+			`</ac:link>`,
+		),
+
 		`ac:jira:ticket`: text(
 			`<ac:structured-macro ac:name="jira">`,
 			`<ac:parameter ac:name="key">{{ .Ticket }}</ac:parameter>`,
@@ -172,6 +269,68 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`</ac:structured-macro>{{printf "\n"}}`,
 		),
 
+		/* https://confluence.atlassian.com/doc/page-properties-macro-184550024.html */
+
+		`ac:details`: text(
+			`<ac:structured-macro ac:name="details">{{printf "\n"}}`,
+			`{{ if .ID }}<ac:parameter ac:name="id">{{ .ID }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`<ac:parameter ac:name="hidden">{{ or .Hidden "false" }}</ac:parameter>{{printf "\n"}}`,
+			`<ac:rich-text-body>{{printf "\n"}}`,
+			`{{ .Body }}{{printf "\n"}}`,
+			`</ac:rich-text-body>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/page-properties-report-macro-186089616.html */
+
+		`ac:details:report`: text(
+			`<ac:structured-macro ac:name="detailssummary">{{printf "\n"}}`,
+			`{{ if .ID }}<ac:parameter ac:name="id">{{ .ID }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .CQL }}<ac:parameter ac:name="cql">{{ .CQL }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Labels }}<ac:parameter ac:name="label">{{ .Labels }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Spaces }}<ac:parameter ac:name="spaces">{{ .Spaces }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Headings }}<ac:parameter ac:name="headings">{{ .Headings }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .SortBy }}<ac:parameter ac:name="sortBy">{{ .SortBy }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`<ac:parameter ac:name="pageSize">{{ or .PageSize "30" }}</ac:parameter>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/recently-updated-macro-139568.html */
+
+		`ac:recently-updated`: text(
+			`<ac:structured-macro ac:name="recently-updated">{{printf "\n"}}`,
+			`{{ if .Spaces }}<ac:parameter ac:name="spaces">{{ .Spaces }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Labels }}<ac:parameter ac:name="labels">{{ .Labels }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Types }}<ac:parameter ac:name="types">{{ .Types }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Theme }}<ac:parameter ac:name="theme">{{ .Theme }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`<ac:parameter ac:name="max">{{ or .Max "15" }}</ac:parameter>{{printf "\n"}}`,
+			`<ac:parameter ac:name="hideHeading">{{ or .HideHeading "false" }}</ac:parameter>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/page-tree-macro-163414255.html */
+
+		`ac:pagetree`: text(
+			`<ac:structured-macro ac:name="pagetree">{{printf "\n"}}`,
+			`<ac:parameter ac:name="root">`,
+			/**/ `<ac:link><ri:page ri:content-title="{{ or .Root "@self" }}"/></ac:link>`,
+			`</ac:parameter>{{printf "\n"}}`,
+			`<ac:parameter ac:name="startDepth">{{ or .Depth "1" }}</ac:parameter>{{printf "\n"}}`,
+			`{{ if .Sort }}<ac:parameter ac:name="sort">{{ .Sort }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`{{ if .Reverse }}<ac:parameter ac:name="reverse">{{ .Reverse }}</ac:parameter>{{printf "\n"}}{{ end }}`,
+			`<ac:parameter ac:name="searchBox">{{ or .SearchBox "false" }}</ac:parameter>{{printf "\n"}}`,
+			`<ac:parameter ac:name="expandCollapseAll">{{ or .ExpandCollapseAll "false" }}</ac:parameter>{{printf "\n"}}`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
+		/* https://confluence.atlassian.com/doc/anchor-macro-182682070.html */
+
+		`ac:anchor`: text(
+			`<ac:structured-macro ac:name="anchor">`,
+			`<ac:parameter ac:name="">{{ .Name }}</ac:parameter>`,
+			`</ac:structured-macro>{{printf "\n"}}`,
+		),
+
 		/* https://confluence.atlassian.com/doc/confluence-storage-format-790796544.html */
 
 		`ac:emoticon`: text(
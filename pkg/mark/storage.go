@@ -0,0 +1,243 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+var reStorageMacroTag = regexp.MustCompile(
+	`<(/?)ac:structured-macro\b[^>]*?(/?)>`,
+)
+
+// extractStorageFragments replaces Confluence macros written in storage
+// format directly in markdown with placeholders, so they are not mangled by
+// markdown renderer. Macros inside code blocks and spans are left as is.
+func extractStorageFragments(markdown []byte) ([]byte, [][]byte) {
+	var (
+		code      = codeRanges(markdown)
+		fragments = [][]byte{}
+		buffer    bytes.Buffer
+		depth     int
+		start     int
+		offset    int
+	)
+
+	for _, tag := range reStorageMacroTag.FindAllSubmatchIndex(markdown, -1) {
+		if insideRanges(code, tag[0]) {
+			continue
+		}
+
+		closing := tag[3] > tag[2]
+		selfClosing := tag[5] > tag[4]
+
+		switch {
+		case closing:
+			if depth == 0 {
+				continue
+			}
+
+			depth--
+
+		case depth == 0:
+			start = tag[0]
+
+			if !selfClosing {
+				depth++
+			}
+
+		case !selfClosing:
+			depth++
+		}
+
+		if depth > 0 {
+			continue
+		}
+
+		buffer.Write(markdown[offset:start])
+		buffer.WriteString(storagePlaceholder(len(fragments)))
+
+		fragments = append(fragments, markdown[start:tag[1]])
+
+		offset = tag[1]
+	}
+
+	if len(fragments) == 0 {
+		return markdown, nil
+	}
+
+	buffer.Write(markdown[offset:])
+
+	return buffer.Bytes(), fragments
+}
+
+// restoreStorageFragments puts macros extracted by extractStorageFragments
+// back into rendered HTML. Paragraphs consisting only of macro are unwrapped.
+func restoreStorageFragments(html []byte, fragments [][]byte) []byte {
+	for i, fragment := range fragments {
+		placeholder := []byte(storagePlaceholder(i))
+
+		html = bytes.ReplaceAll(
+			html,
+			[]byte("<p>"+string(placeholder)+"</p>"),
+			fragment,
+		)
+
+		html = bytes.ReplaceAll(html, placeholder, fragment)
+	}
+
+	return html
+}
+
+func storagePlaceholder(index int) string {
+	return fmt.Sprintf("MARKSTORAGEFRAGMENT%dEND", index)
+}
+
+var reRichTextBodyTag = regexp.MustCompile(`<(/?)ac:rich-text-body>`)
+
+// compileRichTextBodies compiles markdown inside bodies of given macro, like
+// bodies of block macros, using given function. Bodies which start with tag
+// are considered to be written in storage format already and are left as is.
+// Bodies of nested macros are compiled by the function itself.
+func compileRichTextBodies(
+	fragment []byte,
+	compile func([]byte) []byte,
+) []byte {
+	var (
+		buffer bytes.Buffer
+		depth  int
+		start  int
+		offset int
+	)
+
+	for _, tag := range reRichTextBodyTag.FindAllSubmatchIndex(fragment, -1) {
+		if tag[3] == tag[2] {
+			if depth == 0 {
+				start = tag[1]
+			}
+
+			depth++
+
+			continue
+		}
+
+		if depth == 0 {
+			continue
+		}
+
+		depth--
+
+		if depth > 0 {
+			continue
+		}
+
+		body := fragment[start:tag[0]]
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+			continue
+		}
+
+		buffer.Write(fragment[offset:start])
+		buffer.WriteString("\n")
+		buffer.Write(compile(body))
+
+		offset = tag[0]
+	}
+
+	buffer.Write(fragment[offset:])
+
+	return buffer.Bytes()
+}
+
+var reHTMLContainerTag = regexp.MustCompile(
+	`(?m)^<(/?)(div|section|article|aside|figure|details)\b[^>]*>[ \t]*$`,
+)
+
+// extractHTMLContainers replaces opening and closing tags of block-level HTML
+// containers like <div>, which are separated from their contents by blank
+// lines, with placeholders, so markdown inside them is rendered instead of
+// being passed as is. Only complete pairs of tags are replaced, otherwise
+// rendered paragraphs would be mis-nested with remaining raw tags.
+// Placeholders are restored by restoreStorageFragments.
+func extractHTMLContainers(
+	markdown []byte,
+	fragments [][]byte,
+) ([]byte, [][]byte) {
+	type opening struct {
+		name  string
+		tag   []int
+		blank bool
+	}
+
+	var (
+		code   = codeRanges(markdown)
+		stack  = []opening{}
+		pairs  = map[int]bool{}
+		tags   = reHTMLContainerTag.FindAllSubmatchIndex(markdown, -1)
+		buffer bytes.Buffer
+		offset int
+	)
+
+	for _, tag := range tags {
+		if insideRanges(code, tag[0]) {
+			continue
+		}
+
+		name := string(markdown[tag[4]:tag[5]])
+
+		if tag[3] == tag[2] {
+			stack = append(stack, opening{
+				name:  name,
+				tag:   tag,
+				blank: blankLineAfter(markdown, tag[1]),
+			})
+
+			continue
+		}
+
+		if len(stack) == 0 || stack[len(stack)-1].name != name {
+			continue
+		}
+
+		open := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if open.blank && blankLineBefore(markdown, tag[0]) {
+			pairs[open.tag[0]] = true
+			pairs[tag[0]] = true
+		}
+	}
+
+	for _, tag := range tags {
+		if !pairs[tag[0]] {
+			continue
+		}
+
+		buffer.Write(markdown[offset:tag[0]])
+		buffer.WriteString("\n" + storagePlaceholder(len(fragments)) + "\n")
+
+		fragments = append(fragments, markdown[tag[0]:tag[1]])
+
+		offset = tag[1]
+	}
+
+	buffer.Write(markdown[offset:])
+
+	return buffer.Bytes(), fragments
+}
+
+func blankLineAfter(markdown []byte, offset int) bool {
+	rest := bytes.TrimPrefix(markdown[offset:], []byte("\n"))
+	line := rest
+	if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+		line = rest[:end]
+	}
+
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+func blankLineBefore(markdown []byte, offset int) bool {
+	head := bytes.TrimSuffix(markdown[:offset], []byte("\n"))
+	line := head[bytes.LastIndexByte(head, '\n')+1:]
+
+	return len(bytes.TrimSpace(line)) == 0
+}
@@ -0,0 +1,53 @@
+package mark
+
+import (
+	"fmt"
+	"io"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// renderWideTable wraps tables which have at least WideTableColumns columns
+// into horizontally scrollable container, so they don't break page layout.
+// It returns false if table should be rendered as is.
+func (renderer ConfluenceRenderer) renderWideTable(
+	writer io.Writer,
+	node *bf.Node,
+	entering bool,
+) bool {
+	if renderer.WideTableColumns <= 0 ||
+		tableColumns(node) < renderer.WideTableColumns {
+		return false
+	}
+
+	if entering {
+		fmt.Fprint(
+			writer,
+			`<div class="table-wrap" style="overflow-x: auto;">`+"\n",
+		)
+
+		renderer.Renderer.RenderNode(writer, node, entering)
+	} else {
+		renderer.Renderer.RenderNode(writer, node, entering)
+
+		fmt.Fprint(writer, "</div>\n")
+	}
+
+	return true
+}
+
+// tableColumns returns number of cells in the first row of the table.
+func tableColumns(table *bf.Node) int {
+	columns := 0
+
+	section := table.FirstChild
+	if section == nil || section.FirstChild == nil {
+		return columns
+	}
+
+	for cell := section.FirstChild.FirstChild; cell != nil; cell = cell.Next {
+		columns++
+	}
+
+	return columns
+}
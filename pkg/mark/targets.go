@@ -0,0 +1,31 @@
+package mark
+
+import (
+	"net/url"
+)
+
+// isNewWindowLink checks that given link is external link to one of domains,
+// links to which open in new window. Links to Confluence itself, relative
+// links and links with other schemes like mailto: are internal.
+func (renderer ConfluenceRenderer) isNewWindowLink(link string) bool {
+	if len(renderer.NewWindowDomains) == 0 {
+		return false
+	}
+
+	uri, err := url.Parse(link)
+	if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") {
+		return false
+	}
+
+	if matchDomains(link, renderer.InternalDomains) {
+		return false
+	}
+
+	for _, domain := range renderer.NewWindowDomains {
+		if domain == "*" {
+			return true
+		}
+	}
+
+	return matchDomains(link, renderer.NewWindowDomains)
+}
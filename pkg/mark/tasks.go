@@ -0,0 +1,116 @@
+package mark
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	bf "github.com/kovetskiy/blackfriday/v2"
+)
+
+// - [ ] @assignee 2024-12-01 task text
+var reTask = regexp.MustCompile(
+	`^(?:MARKLISTITEM\d+END )?` +
+		`\[([ xX])\]\s+` +
+		`(?:@(\S+)\s+)?` +
+		`(?:(\d{4}-\d{2}-\d{2})\s+)?`,
+)
+
+type task struct {
+	Done     bool
+	Assignee string
+	Due      string
+}
+
+// parseTaskList checks that every item of given list starts with task marker
+// like [ ] or [x] and, if so, strips markers from items text and remembers
+// tasks for later rendering.
+func (renderer ConfluenceRenderer) parseTaskList(list *bf.Node) bool {
+	if list.ListFlags&bf.ListTypeDefinition != 0 {
+		return false
+	}
+
+	var (
+		tasks = map[*bf.Node]task{}
+		texts = map[*bf.Node][]byte{}
+	)
+
+	for item := list.FirstChild; item != nil; item = item.Next {
+		text := firstText(item)
+		if text == nil {
+			return false
+		}
+
+		matches := reTask.FindSubmatch(text.Literal)
+		if matches == nil {
+			return false
+		}
+
+		tasks[item] = task{
+			Done:     matches[1][0] != ' ',
+			Assignee: string(matches[2]),
+			Due:      string(matches[3]),
+		}
+
+		texts[text] = text.Literal[len(matches[0]):]
+	}
+
+	for item, task := range tasks {
+		renderer.tasks[item] = task
+	}
+
+	for text, literal := range texts {
+		text.Literal = literal
+	}
+
+	return len(tasks) > 0
+}
+
+func (renderer ConfluenceRenderer) renderTask(
+	writer io.Writer,
+	task task,
+	entering bool,
+) {
+	if !entering {
+		fmt.Fprint(writer, "</ac:task-body>\n</ac:task>\n")
+
+		return
+	}
+
+	status := "incomplete"
+	if task.Done {
+		status = "complete"
+	}
+
+	fmt.Fprintf(
+		writer,
+		"<ac:task>\n<ac:task-status>%s</ac:task-status>\n<ac:task-body>",
+		status,
+	)
+
+	if task.Assignee != "" {
+		renderer.Stdlib.Templates.ExecuteTemplate(
+			writer,
+			"ac:link:username",
+			struct {
+				Name string
+			}{
+				task.Assignee,
+			},
+		)
+
+		fmt.Fprint(writer, " ")
+	}
+
+	if task.Due != "" {
+		fmt.Fprintf(writer, `<time datetime="%s" /> `, task.Due)
+	}
+}
+
+func firstText(node *bf.Node) *bf.Node {
+	for node != nil && node.Type != bf.Text {
+		node = node.FirstChild
+	}
+
+	return node
+}
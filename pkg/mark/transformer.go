@@ -0,0 +1,135 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/reconquest/karma-go"
+)
+
+// TransformerCommandPrefix marks transformer specification as external
+// command instead of name of registered transformer.
+const TransformerCommandPrefix = `exec:`
+
+// Transformer changes markdown after includes and macros are processed, but
+// before it's compiled, which allows to add custom syntax without changing
+// mark itself.
+type Transformer interface {
+	Transform(markdown []byte) ([]byte, error)
+}
+
+// TransformerFunc allows to use ordinary function as Transformer.
+type TransformerFunc func(markdown []byte) ([]byte, error)
+
+func (transform TransformerFunc) Transform(markdown []byte) ([]byte, error) {
+	return transform(markdown)
+}
+
+// CommandTransformer runs external command, passing markdown to its stdin
+// and using its stdout as transformed markdown.
+type CommandTransformer struct {
+	Command []string
+}
+
+func (transformer CommandTransformer) Transform(
+	markdown []byte,
+) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(transformer.Command[0], transformer.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(markdown)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, karma.
+			Describe("command", strings.Join(transformer.Command, " ")).
+			Describe("stderr", stderr.String()).
+			Format(err, "transformer command failed")
+	}
+
+	return stdout.Bytes(), nil
+}
+
+var transformers = struct {
+	sync.Mutex
+
+	registered map[string]Transformer
+}{
+	registered: map[string]Transformer{},
+}
+
+// RegisterTransformer makes transformer available by name for using in
+// configuration file. It's intended to be called from init() of packages
+// compiled into custom mark build.
+func RegisterTransformer(name string, transformer Transformer) {
+	transformers.Lock()
+	defer transformers.Unlock()
+
+	transformers.registered[name] = transformer
+}
+
+// LoadTransformers returns transformers by their specifications, which are
+// either names of registered transformers or command lines prefixed with
+// exec:, like "exec:./scripts/expand-tickets --project OPS".
+func LoadTransformers(specs []string) ([]Transformer, error) {
+	transformers.Lock()
+	defer transformers.Unlock()
+
+	result := []Transformer{}
+
+	for _, spec := range specs {
+		if strings.HasPrefix(spec, TransformerCommandPrefix) {
+			command := strings.Fields(
+				strings.TrimPrefix(spec, TransformerCommandPrefix),
+			)
+			if len(command) == 0 {
+				return nil, fmt.Errorf(
+					"transformer %q doesn't specify command",
+					spec,
+				)
+			}
+
+			result = append(result, CommandTransformer{Command: command})
+
+			continue
+		}
+
+		transformer, ok := transformers.registered[spec]
+		if !ok {
+			names := []string{}
+			for name := range transformers.registered {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			return nil, karma.
+				Describe("registered", strings.Join(names, ", ")).
+				Format(nil, "unknown transformer %q", spec)
+		}
+
+		result = append(result, transformer)
+	}
+
+	return result, nil
+}
+
+// Transform applies transformers to markdown in order.
+func Transform(markdown []byte, transformers []Transformer) ([]byte, error) {
+	for _, transformer := range transformers {
+		var err error
+
+		markdown, err = transformer.Transform(markdown)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return markdown, nil
+}
@@ -0,0 +1,37 @@
+package mark
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransform(t *testing.T) {
+	test := assert.New(t)
+
+	RegisterTransformer("shipit", TransformerFunc(
+		func(markdown []byte) ([]byte, error) {
+			return bytes.ReplaceAll(markdown, []byte(":shipit:"), []byte("🚀")), nil
+		},
+	))
+
+	transformers, err := LoadTransformers([]string{
+		"shipit",
+		"exec:tr a-z A-Z",
+	})
+	test.NoError(err)
+
+	markdown, err := Transform([]byte("ready :shipit:\n"), transformers)
+	test.NoError(err)
+	test.Equal("READY 🚀\n", string(markdown))
+
+	_, err = LoadTransformers([]string{"unknown"})
+	test.Error(err)
+
+	transformers, err = LoadTransformers([]string{"exec:false"})
+	test.NoError(err)
+
+	_, err = Transform([]byte("text"), transformers)
+	test.Error(err)
+}
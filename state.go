@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kovetskiy/mark/pkg/mark"
+	"github.com/reconquest/karma-go"
+)
+
+// State keeps track of files successfully uploaded during previous runs, so
+// interrupted run can be resumed without uploading unchanged files again.
+type State struct {
+	path string
+
+	mutex sync.Mutex
+
+	Files map[string]StateEntry `json:"files"`
+}
+
+type StateEntry struct {
+	Checksum string `json:"checksum"`
+	PageID   string `json:"page_id"`
+	Version  int64  `json:"version"`
+}
+
+func LoadState(path string) (*State, error) {
+	state := &State{
+		path:  path,
+		Files: map[string]StateEntry{},
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+
+		return nil, karma.Format(err, "unable to read state file %q", path)
+	}
+
+	err = json.Unmarshal(contents, state)
+	if err != nil {
+		return nil, karma.Format(err, "unable to decode state file %q", path)
+	}
+
+	if state.Files == nil {
+		state.Files = map[string]StateEntry{}
+	}
+
+	return state, nil
+}
+
+// Unchanged reports whether file with given checksum has been already
+// uploaded.
+func (state *State) Unchanged(file string, checksum string) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	entry, ok := state.Files[file]
+
+	return ok && entry.Checksum == checksum
+}
+
+// PageID returns ID of the page given file was last uploaded to, or empty
+// string if the file wasn't uploaded.
+func (state *State) PageID(file string) string {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	return state.Files[file].PageID
+}
+
+// Version returns version of the page after given file was last uploaded to
+// it, or zero if the file was uploaded to another page or wasn't uploaded.
+func (state *State) Version(file string, pageID string) int64 {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	entry, ok := state.Files[file]
+	if !ok || entry.PageID != pageID {
+		return 0
+	}
+
+	return entry.Version
+}
+
+// Update records uploaded file and immediately saves the state, so it
+// survives failure of subsequent uploads.
+func (state *State) Update(file string, entry StateEntry) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.Files[file] = entry
+
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(state.path), ".mark-state-")
+	if err != nil {
+		return karma.Format(err, "unable to create temporary state file")
+	}
+
+	_, err = temp.Write(contents)
+	if err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), state.path)
+	}
+
+	if err != nil {
+		os.Remove(temp.Name())
+
+		return karma.Format(err, "unable to write state file %q", state.path)
+	}
+
+	return nil
+}
+
+// rememberFolder records page, which given index file skipped as unchanged
+// was last uploaded to, as page of its directory, so pages of new files in
+// the directory are created under it, see mark.Folders.
+func rememberFolder(
+	folders *mark.Folders,
+	state *State,
+	file string,
+	key string,
+) {
+	folders.Set(file, state.PageID(key))
+}
+
+// hasSkippedAttachments reports whether upload of any of given attachments
+// has been skipped because of error.
+func hasSkippedAttachments(attaches []mark.Attachment) bool {
+	for _, attach := range attaches {
+		if attach.Skipped {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stateKey returns key, which given file is recorded in state by. Files of
+// bundle are extracted into temporary directory, so they are recorded by
+// path of the bundle and their path inside the bundle.
+func stateKey(file string, bundle string) string {
+	if bundle == "" {
+		return file
+	}
+
+	dir, err := mark.BundleDir(bundle)
+	if err != nil {
+		return file
+	}
+
+	path, err := filepath.Rel(dir, file)
+	if err != nil || strings.HasPrefix(path, "..") {
+		return file
+	}
+
+	return bundle + ":" + filepath.ToSlash(path)
+}
+
+// getChecksum returns checksum of page contents, metadata and attachments.
+func getChecksum(
+	markdown []byte,
+	meta *mark.Meta,
+	dirs []string,
+) (string, error) {
+	hash := sha256.New()
+	hash.Write(markdown)
+
+	var attachments map[string]string
+	if meta != nil {
+		attachments = meta.Attachments
+
+		// version is written into headers by --write-back after every
+		// upload, so it would make file changed on every run
+		headers := *meta
+		headers.Version = 0
+
+		encoded, err := json.Marshal(headers)
+		if err != nil {
+			return "", karma.Format(err, "unable to encode metadata")
+		}
+
+		hash.Write(encoded)
+	}
+
+	names := []string{}
+	for _, name := range attachments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		path, err := mark.FindAttachment(dirs, name)
+		if err != nil {
+			return "", err
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", karma.Format(err, "unable to read attachment %q", path)
+		}
+
+		hash.Write([]byte(name))
+		hash.Write(contents)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
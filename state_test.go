@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/pkg/mark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRememberFolder(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	err = ioutil.WriteFile(path, []byte(`{
+		"files": {
+			"docs/index.md": {"checksum": "a", "page_id": "10", "version": 2}
+		}
+	}`), 0644)
+	test.NoError(err)
+
+	state, err := LoadState(path)
+	test.NoError(err)
+
+	folders := mark.NewFolders(mark.DefaultIndexFilenames)
+
+	// index file is skipped as unchanged, while its new sibling is not
+	test.True(state.Unchanged("docs/index.md", "a"))
+
+	rememberFolder(folders, state, "docs/index.md", "docs/index.md")
+
+	parent, ok := folders.Parent("docs/new.md")
+	test.True(ok)
+	test.Equal("10", parent)
+
+	parent, ok = folders.Parent("docs/setup/new.md")
+	test.True(ok)
+	test.Equal("10", parent)
+
+	// index file which was never uploaded doesn't have page
+	rememberFolder(folders, state, "blog/index.md", "blog/index.md")
+
+	_, ok = folders.Parent("blog/new.md")
+	test.False(ok)
+
+	rememberFolder(nil, state, "docs/index.md", "docs/index.md")
+}
+
+func TestState_SkippedAttachments(t *testing.T) {
+	test := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mark")
+	test.NoError(err)
+
+	defer os.RemoveAll(dir)
+
+	state, err := LoadState(filepath.Join(dir, "state.json"))
+	test.NoError(err)
+
+	test.False(hasSkippedAttachments([]mark.Attachment{{Name: "a.png"}}))
+
+	attaches := []mark.Attachment{{Name: "a.png"}, {Name: "b.png", Skipped: true}}
+	test.True(hasSkippedAttachments(attaches))
+
+	// file with skipped attachments is recorded without checksum, so it's
+	// uploaded again on next run
+	test.NoError(state.Update("doc.md", StateEntry{PageID: "10", Version: 2}))
+
+	state, err = LoadState(filepath.Join(dir, "state.json"))
+	test.NoError(err)
+
+	test.False(state.Unchanged("doc.md", "a"))
+	test.Equal("10", state.PageID("doc.md"))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/kovetskiy/lorg"
+)
+
+// Warnings is a log output which collects warnings logged during the run,
+// so they can fail the run with --strict.
+type Warnings struct {
+	lorg.SmartOutput
+
+	messages []string
+	mutex    sync.Mutex
+}
+
+func (warnings *Warnings) WriteWithLevel(
+	data []byte,
+	level lorg.Level,
+) (int, error) {
+	if level == lorg.LevelWarning {
+		warnings.mutex.Lock()
+		warnings.messages = append(
+			warnings.messages,
+			strings.TrimSpace(string(data)),
+		)
+		warnings.mutex.Unlock()
+	}
+
+	return warnings.SmartOutput.WriteWithLevel(data, level)
+}
+
+func (warnings *Warnings) Messages() []string {
+	warnings.mutex.Lock()
+	defer warnings.mutex.Unlock()
+
+	return append([]string{}, warnings.messages...)
+}